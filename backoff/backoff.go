@@ -61,9 +61,7 @@ type ExponentialBackoffEqualJitterStrategy struct {
 
 // Backoff 重试
 func (stg ExponentialBackoffEqualJitterStrategy) Backoff(retry int) time.Duration {
-	v := stg.expo(retry)
-	u := uniform(0, v/2.0)
-	return time.Duration(v/2.0 + u)
+	return stg.sample(retry, 0, nil)
 }
 
 // ExponentialBackoffFullJitterStrategy 指数full jitter重试
@@ -73,9 +71,7 @@ type ExponentialBackoffFullJitterStrategy struct {
 
 // Backoff 重试
 func (stg ExponentialBackoffFullJitterStrategy) Backoff(retry int) time.Duration {
-	v := stg.expo(retry)
-	u := uniform(0, v)
-	return time.Duration(u)
+	return stg.sample(retry, 0, nil)
 }
 
 // ExponentialBackoffDecorrelatedJitterStrategy 指数decorrelated jitter重试
@@ -84,9 +80,12 @@ type ExponentialBackoffDecorrelatedJitterStrategy struct {
 	sleep time.Duration
 }
 
-// uniform returns a number in [min, max)
-func uniform(min, max float64) float64 {
-	return min + rand.Float64()*(max-min)
+// uniform returns a number in [min, max) drawn from rng, the global source if rng is nil.
+func uniform(rng *rand.Rand, min, max float64) float64 {
+	if rng == nil {
+		return min + rand.Float64()*(max-min)
+	}
+	return min + rng.Float64()*(max-min)
 }
 
 // Backoff 重试
@@ -94,7 +93,7 @@ func (stg ExponentialBackoffDecorrelatedJitterStrategy) Backoff(retry int) time.
 	c := float64(stg.Cap)
 	b := float64(stg.Base)
 	s := float64(stg.sleep)
-	u := uniform(b, 3*s)
+	u := uniform(nil, b, 3*s)
 	s = math.Min(c, u)
 	return time.Duration(s)
 }
@@ -0,0 +1,59 @@
+package backoff
+
+import "time"
+
+// bounded is implemented by strategies which know the largest delay a retry can produce.
+type bounded interface {
+	upper(retry int) time.Duration
+}
+
+func (stg LinearBackoffStrategy) upper(retry int) time.Duration {
+	return stg.Backoff(retry)
+}
+
+func (stg ConstantBackOffStrategy) upper(retry int) time.Duration {
+	return stg.interval
+}
+
+func (stg ExponentialBackoffStrategy) upper(retry int) time.Duration {
+	return time.Duration(stg.expo(retry))
+}
+
+func (stg ExponentialBackoffEqualJitterStrategy) upper(retry int) time.Duration {
+	return time.Duration(stg.expo(retry))
+}
+
+func (stg ExponentialBackoffFullJitterStrategy) upper(retry int) time.Duration {
+	return time.Duration(stg.expo(retry))
+}
+
+func (stg ExponentialBackoffDecorrelatedJitterStrategy) upper(retry int) time.Duration {
+	return stg.Cap
+}
+
+func (stg ScheduleBackoff) upper(retry int) time.Duration {
+	return stg.Backoff(retry)
+}
+
+// Upper returns the largest delay strategy can produce for retry, the
+// un-jittered delay for the jittered strategies of this package. Any other
+// strategy is assumed to be deterministic and returns Backoff(retry).
+func Upper(strategy Strategy, retry int) time.Duration {
+	if b, ok := strategy.(bounded); ok {
+		return b.upper(retry)
+	}
+	return strategy.Backoff(retry)
+}
+
+// MaxElapsed returns the worst-case total of the delays for retries 0 to
+// attempts-1, to pick a caller timeout without trial and error. It only
+// counts waiting, not the attempts themselves. No retry loop of lizard stops
+// on elapsed time on its own: to cut a loop short at run time, bound it with
+// a context deadline of at least MaxElapsed plus the time attempts take.
+func MaxElapsed(strategy Strategy, attempts int) time.Duration {
+	var total time.Duration
+	for i := 0; i < attempts; i++ {
+		total += Upper(strategy, i)
+	}
+	return total
+}
@@ -0,0 +1,50 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaxElapsed(t *testing.T) {
+	expo := ExponentialBackoff{
+		Base: 10 * time.Millisecond,
+		Cap:  50 * time.Millisecond,
+	}
+	tests := [...]struct {
+		Strategy Strategy
+		Attempts int
+		Want     time.Duration
+	}{
+		0: {
+			ConstantBackOffStrategy{interval: time.Second},
+			3,
+			3 * time.Second,
+		},
+		1: {
+			LinearBackoffStrategy{slope: time.Second},
+			3,
+			3 * time.Second,
+		},
+		2: {
+			ExponentialBackoffFullJitterStrategy{ExponentialBackoff: expo},
+			4,
+			(10 + 20 + 40 + 50) * time.Millisecond,
+		},
+		3: {
+			ExponentialBackoffEqualJitterStrategy{ExponentialBackoff: expo},
+			0,
+			0,
+		},
+		4: {
+			schedule,
+			5,
+			(100 + 500 + 2000 + 5000 + 5000) * time.Millisecond,
+		},
+	}
+	for i, test := range tests {
+		got := MaxElapsed(test.Strategy, test.Attempts)
+		if got != test.Want {
+			t.Errorf("case: %d, want: %s, got: %s", i, test.Want, got)
+		}
+	}
+}
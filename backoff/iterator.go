@@ -0,0 +1,60 @@
+package backoff
+
+import (
+	"math"
+	"time"
+)
+
+// Stop indicates that no more retries should be made.
+const Stop time.Duration = -1
+
+// BackOff 有状态的重试间隔迭代器，同一个BackOff不可用于并发环境中.
+type BackOff interface {
+	// NextBackOff returns the duration to wait before the next retry, or Stop.
+	NextBackOff() time.Duration
+	// Reset restores the initial state.
+	Reset()
+}
+
+type strategyBackOff struct {
+	strategy Strategy
+	retry    int
+}
+
+// NewStrategyBackOff iterates a stateless Strategy, the n-th call returns strategy.Backoff(n).
+func NewStrategyBackOff(strategy Strategy) BackOff {
+	return &strategyBackOff{strategy: strategy}
+}
+
+func (b *strategyBackOff) NextBackOff() time.Duration {
+	d := b.strategy.Backoff(b.retry)
+	b.retry++
+	return d
+}
+
+func (b *strategyBackOff) Reset() {
+	b.retry = 0
+}
+
+// DecorrelatedJitter 有状态的decorrelated jitter重试，
+// 每次返回min(Cap, uniform(Base, 3*上一次的间隔)).
+type DecorrelatedJitter struct {
+	ExponentialBackoff
+	sleep time.Duration
+}
+
+// NextBackOff 重试
+func (b *DecorrelatedJitter) NextBackOff() time.Duration {
+	if b.sleep < b.Base {
+		b.sleep = b.Base
+	}
+	c := float64(b.Cap)
+	u := uniform(nil, float64(b.Base), 3*float64(b.sleep))
+	b.sleep = time.Duration(math.Min(c, u))
+	return b.sleep
+}
+
+// Reset 重置
+func (b *DecorrelatedJitter) Reset() {
+	b.sleep = 0
+}
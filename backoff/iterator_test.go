@@ -0,0 +1,51 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecorrelatedJitter(t *testing.T) {
+	b := &DecorrelatedJitter{
+		ExponentialBackoff: ExponentialBackoff{
+			Base: 10 * time.Millisecond,
+			Cap:  time.Second,
+		},
+	}
+	prev := b.Base
+	for i := 0; i < 100; i++ {
+		d := b.NextBackOff()
+		if d < b.Base || d > b.Cap || d > 3*prev {
+			t.Fatalf("retry: %d, got: %s, out of [%s, min(%s, %s)]", i, d, b.Base, b.Cap, 3*prev)
+		}
+		prev = d
+	}
+	b.Reset()
+	if d := b.NextBackOff(); d > 3*b.Base {
+		t.Errorf("after reset got: %s, want at most %s", d, 3*b.Base)
+	}
+}
+
+func TestStrategyBackOff(t *testing.T) {
+	b := NewStrategyBackOff(ExponentialBackoffStrategy{
+		ExponentialBackoff: ExponentialBackoff{
+			Base: time.Millisecond,
+			Cap:  4 * time.Millisecond,
+		},
+	})
+	want := [...]time.Duration{
+		time.Millisecond,
+		2 * time.Millisecond,
+		4 * time.Millisecond,
+		4 * time.Millisecond,
+	}
+	for i, w := range want {
+		if got := b.NextBackOff(); got != w {
+			t.Errorf("retry: %d, want: %s, got: %s", i, w, got)
+		}
+	}
+	b.Reset()
+	if got := b.NextBackOff(); got != want[0] {
+		t.Errorf("after reset want: %s, got: %s", want[0], got)
+	}
+}
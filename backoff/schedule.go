@@ -0,0 +1,73 @@
+package backoff
+
+import (
+	"errors"
+	"time"
+)
+
+// ScheduleBackoff 按固定时间表重试，例如从配置读取的100ms, 500ms, 2s, 5s.
+// Build it with NewScheduleBackoff: an empty schedule retries without delay
+// and its Iterator stops at once.
+type ScheduleBackoff struct {
+	Delays []time.Duration
+}
+
+// NewScheduleBackoff returns the schedule of delays, an error if Validate
+// rejects it. delays is copied.
+func NewScheduleBackoff(delays []time.Duration) (ScheduleBackoff, error) {
+	stg := ScheduleBackoff{Delays: append([]time.Duration(nil), delays...)}
+	if err := stg.Validate(); err != nil {
+		return ScheduleBackoff{}, err
+	}
+	return stg, nil
+}
+
+// Validate reports a schedule which is empty or has a negative delay.
+func (stg ScheduleBackoff) Validate() error {
+	if len(stg.Delays) == 0 {
+		return errors.New("schedule is empty")
+	}
+	for _, d := range stg.Delays {
+		if d < 0 {
+			return errors.New("schedule has a negative delay")
+		}
+	}
+	return nil
+}
+
+// Backoff 重试，超出时间表后一直返回最后一个间隔
+func (stg ScheduleBackoff) Backoff(retry int) time.Duration {
+	if len(stg.Delays) == 0 {
+		return 0
+	}
+	if retry < 0 {
+		retry = 0
+	}
+	if retry >= len(stg.Delays) {
+		retry = len(stg.Delays) - 1
+	}
+	return stg.Delays[retry]
+}
+
+// Iterator returns a BackOff walking the schedule once, it returns Stop past its end.
+func (stg ScheduleBackoff) Iterator() BackOff {
+	return &scheduleBackOff{delays: stg.Delays}
+}
+
+type scheduleBackOff struct {
+	delays []time.Duration
+	retry  int
+}
+
+func (b *scheduleBackOff) NextBackOff() time.Duration {
+	if b.retry >= len(b.delays) {
+		return Stop
+	}
+	d := b.delays[b.retry]
+	b.retry++
+	return d
+}
+
+func (b *scheduleBackOff) Reset() {
+	b.retry = 0
+}
@@ -0,0 +1,104 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+var schedule = ScheduleBackoff{
+	Delays: []time.Duration{
+		100 * time.Millisecond,
+		500 * time.Millisecond,
+		2 * time.Second,
+		5 * time.Second,
+	},
+}
+
+func TestScheduleBackoff(t *testing.T) {
+	tests := [...]struct {
+		Retry int
+		Want  time.Duration
+	}{
+		0: {
+			0,
+			100 * time.Millisecond,
+		},
+		1: {
+			3,
+			5 * time.Second,
+		},
+		2: {
+			4,
+			5 * time.Second,
+		},
+		3: {
+			100,
+			5 * time.Second,
+		},
+	}
+	for _, test := range tests {
+		got := schedule.Backoff(test.Retry)
+		if got != test.Want {
+			t.Errorf("retry: %d, want: %s, got: %s", test.Retry, test.Want, got)
+		}
+	}
+}
+
+func TestScheduleBackoffIterator(t *testing.T) {
+	b := schedule.Iterator()
+	for i, want := range schedule.Delays {
+		if got := b.NextBackOff(); got != want {
+			t.Errorf("retry: %d, want: %s, got: %s", i, want, got)
+		}
+	}
+	if got := b.NextBackOff(); got != Stop {
+		t.Errorf("past the end want: Stop, got: %s", got)
+	}
+	b.Reset()
+	if got := b.NextBackOff(); got != schedule.Delays[0] {
+		t.Errorf("after reset want: %s, got: %s", schedule.Delays[0], got)
+	}
+}
+
+func TestScheduleBackoffValidate(t *testing.T) {
+	tests := [...]struct {
+		In    ScheduleBackoff
+		Valid bool
+	}{
+		0: {
+			ScheduleBackoff{},
+			false,
+		},
+		1: {
+			ScheduleBackoff{Delays: []time.Duration{time.Second, -time.Second}},
+			false,
+		},
+		2: {
+			schedule,
+			true,
+		},
+	}
+	for i, test := range tests {
+		if err := test.In.Validate(); (err == nil) != test.Valid {
+			t.Errorf("case: %d, valid: %t, got err: %v", i, test.Valid, err)
+		}
+	}
+}
+
+func TestNewScheduleBackoff(t *testing.T) {
+	if _, err := NewScheduleBackoff(nil); err == nil {
+		t.Error("an empty schedule should be rejected")
+	}
+	if _, err := NewScheduleBackoff([]time.Duration{-time.Second}); err == nil {
+		t.Error("a negative delay should be rejected")
+	}
+	delays := []time.Duration{time.Second, 2 * time.Second}
+	stg, err := NewScheduleBackoff(delays)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delays[0] = 0
+	if got := stg.Backoff(0); got != time.Second {
+		t.Errorf("want: %s, got: %s, the delays should be copied", time.Second, got)
+	}
+}
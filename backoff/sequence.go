@@ -0,0 +1,70 @@
+package backoff
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// sampler is implemented by the jittered strategies to draw delays from a given source.
+type sampler interface {
+	// sample returns the delay of retry given the delay of the previous retry.
+	sample(retry int, prev time.Duration, rng *rand.Rand) time.Duration
+}
+
+func (stg ExponentialBackoffEqualJitterStrategy) sample(retry int, _ time.Duration, rng *rand.Rand) time.Duration {
+	v := stg.expo(retry)
+	u := uniform(rng, 0, v/2.0)
+	return time.Duration(v/2.0 + u)
+}
+
+func (stg ExponentialBackoffFullJitterStrategy) sample(retry int, _ time.Duration, rng *rand.Rand) time.Duration {
+	v := stg.expo(retry)
+	u := uniform(rng, 0, v)
+	return time.Duration(u)
+}
+
+// sample follows DecorrelatedJitter, each delay depends on the previous one.
+func (stg ExponentialBackoffDecorrelatedJitterStrategy) sample(
+	retry int, prev time.Duration, rng *rand.Rand,
+) time.Duration {
+	if prev < stg.Base {
+		prev = stg.Base
+	}
+	u := uniform(rng, float64(stg.Base), 3*float64(prev))
+	return time.Duration(math.Min(float64(stg.Cap), u))
+}
+
+// Sequence returns the delays of retries 0 to attempts-1. For the jittered
+// strategies of this package it is the deterministic base sequence, the
+// delays before jitter as returned by Upper; see Sample for actual delays.
+func Sequence(strategy Strategy, attempts int) []time.Duration {
+	if attempts <= 0 {
+		return nil
+	}
+	seq := make([]time.Duration, attempts)
+	for i := range seq {
+		seq[i] = Upper(strategy, i)
+	}
+	return seq
+}
+
+// Sample returns delays for retries 0 to attempts-1 drawn with rng, so that a
+// seeded rng makes the jittered strategies reproducible. Deterministic
+// strategies return the same as Sequence.
+func Sample(strategy Strategy, attempts int, rng *rand.Rand) []time.Duration {
+	if attempts <= 0 {
+		return nil
+	}
+	s, ok := strategy.(sampler)
+	if !ok {
+		return Sequence(strategy, attempts)
+	}
+	seq := make([]time.Duration, attempts)
+	var prev time.Duration
+	for i := range seq {
+		seq[i] = s.sample(i, prev, rng)
+		prev = seq[i]
+	}
+	return seq
+}
@@ -0,0 +1,66 @@
+package backoff
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSequence(t *testing.T) {
+	expo := ExponentialBackoff{
+		Base: 10 * time.Millisecond,
+		Cap:  50 * time.Millisecond,
+	}
+	tests := [...]struct {
+		Strategy Strategy
+		Attempts int
+		Want     []time.Duration
+	}{
+		0: {
+			LinearBackoffStrategy{slope: time.Second},
+			3,
+			[]time.Duration{0, time.Second, 2 * time.Second},
+		},
+		1: {
+			ExponentialBackoffFullJitterStrategy{ExponentialBackoff: expo},
+			4,
+			[]time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond},
+		},
+		2: {
+			ConstantBackOffStrategy{interval: time.Second},
+			0,
+			nil,
+		},
+	}
+	for i, test := range tests {
+		if got := Sequence(test.Strategy, test.Attempts); !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("%d: want: %v, got: %v", i, test.Want, got)
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	expo := ExponentialBackoff{
+		Base: 10 * time.Millisecond,
+		Cap:  50 * time.Millisecond,
+	}
+	strategies := []Strategy{
+		ExponentialBackoffEqualJitterStrategy{ExponentialBackoff: expo},
+		ExponentialBackoffFullJitterStrategy{ExponentialBackoff: expo},
+		ExponentialBackoffDecorrelatedJitterStrategy{ExponentialBackoff: expo},
+		ConstantBackOffStrategy{interval: time.Second},
+	}
+	for i, strategy := range strategies {
+		a := Sample(strategy, 8, rand.New(rand.NewSource(1)))
+		b := Sample(strategy, 8, rand.New(rand.NewSource(1)))
+		if !reflect.DeepEqual(a, b) {
+			t.Errorf("%d: the same seed sampled %v and %v", i, a, b)
+		}
+		for retry, d := range a {
+			if d < 0 || d > Upper(strategy, retry) {
+				t.Errorf("%d: retry %d sampled %s above %s", i, retry, d, Upper(strategy, retry))
+			}
+		}
+	}
+}
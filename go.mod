@@ -3,7 +3,9 @@ module github.com/xiaojiaoyu100/lizard
 go 1.14
 
 require (
+	github.com/alicebob/miniredis/v2 v2.30.5
 	github.com/go-redis/redis/v7 v7.2.0
+	github.com/gomodule/redigo v1.8.2
 	github.com/onsi/ginkgo v1.10.2 // indirect
 	golang.org/x/net v0.0.0-20200226121028-0de0cce0169b // indirect
 	golang.org/x/sys v0.0.0-20191026070338-33540a1f6037 // indirect
@@ -0,0 +1,187 @@
+// Package delayqueue provides a redis backed queue of jobs delivered after a delay.
+package delayqueue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/script"
+	"github.com/xiaojiaoyu100/lizard/timekit"
+)
+
+const (
+	pushScript    = script.DelayQueuePush
+	pollScript    = script.DelayQueuePoll
+	ackScript     = script.DelayQueueAck
+	nackScript    = script.DelayQueueNack
+	deadScript    = script.DelayQueueDead
+	requeueScript = script.DelayQueueRequeue
+)
+
+// Job is a delivered job.
+type Job struct {
+	ID       string
+	Payload  []byte
+	Attempts int // deliveries so far, including this one
+}
+
+// DelayQueue is a queue of jobs delivered after a delay. A polled job is
+// hidden for the visibility timeout and delivered again unless it is acked,
+// so a crashing worker loses no job. A job already delivered the max
+// attempts is moved to the dead letters instead, so that a poison job which
+// crashes every worker does not clog the queue.
+type DelayQueue struct {
+	redis  rediser
+	keys   []string
+	option option
+}
+
+// New 生成一个延迟队列，所有key共享name的hash tag.
+func New(redis rediser, name string, setters ...Setter) (*DelayQueue, error) {
+	if name == "" {
+		return nil, errors.New("name length is zero")
+	}
+	o := option{
+		maxAttempts:       5,
+		visibilityTimeout: 30 * time.Second,
+	}
+	for _, setter := range setters {
+		if err := setter(&o); err != nil {
+			return nil, err
+		}
+	}
+	prefix := "delayqueue:{" + name + "}:"
+	return &DelayQueue{
+		redis:  redis,
+		keys:   []string{prefix + "pending", prefix + "payloads", prefix + "attempts", prefix + "dead"},
+		option: o,
+	}, nil
+}
+
+// Push enqueues payload to be delivered after delay and returns the job id.
+func (q *DelayQueue) Push(ctx context.Context, payload []byte, delay time.Duration) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	due := timekit.NowInMillis() + timekit.DurationToMillis(delay)
+	if err := q.redis.Eval(pushScript, q.keys, id, payload, due).Err(); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Poll returns the next due job, nil if there is none.
+func (q *DelayQueue) Poll(ctx context.Context) (*Job, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ret, err := q.redis.Eval(pollScript, q.keys,
+		timekit.NowInMillis(),
+		timekit.DurationToMillis(q.option.visibilityTimeout),
+		q.option.maxAttempts,
+	).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := parseJobs(ret)
+	if err != nil {
+		return nil, err
+	}
+	return jobs[0], nil
+}
+
+// Ack removes a processed job.
+func (q *DelayQueue) Ack(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	n, err := q.redis.Eval(ackScript, q.keys, id).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("id: %s, err: %w", id, errJobNotFound)
+	}
+	return nil
+}
+
+// Nack gives a job back to be delivered again after delay, or moves it to
+// the dead letters if it has been delivered max attempts times already.
+func (q *DelayQueue) Nack(ctx context.Context, id string, delay time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	due := timekit.NowInMillis() + timekit.DurationToMillis(delay)
+	n, err := q.redis.Eval(nackScript, q.keys, id, due, q.option.maxAttempts).Int64()
+	if err != nil {
+		return err
+	}
+	if n == -1 {
+		return fmt.Errorf("id: %s, err: %w", id, errJobNotFound)
+	}
+	return nil
+}
+
+// DeadLetters returns up to n dead jobs, oldest first.
+func (q *DelayQueue) DeadLetters(ctx context.Context, n int) ([]*Job, error) {
+	if n < 1 {
+		return nil, errors.New("n is less than 1")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ret, err := q.redis.Eval(deadScript, q.keys, n).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseJobs(ret)
+}
+
+// Requeue moves a dead job back to the queue with its attempts reset, e.g.
+// once the bug which poisoned it is fixed.
+func (q *DelayQueue) Requeue(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	n, err := q.redis.Eval(requeueScript, q.keys, id, timekit.NowInMillis()).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("id: %s, err: %w", id, errJobNotFound)
+	}
+	return nil
+}
+
+// parseJobs parses the flat id, payload, attempts triples of a script reply.
+func parseJobs(ret interface{}) ([]*Job, error) {
+	values, ok := ret.([]interface{})
+	if !ok || len(values)%3 != 0 {
+		return nil, fmt.Errorf("unexpected reply: %v", ret)
+	}
+	jobs := make([]*Job, 0, len(values)/3)
+	for i := 0; i < len(values); i += 3 {
+		id, _ := values[i].(string)
+		payload, _ := values[i+1].(string)
+		attempts, _ := values[i+2].(int64)
+		jobs = append(jobs, &Job{
+			ID:       id,
+			Payload:  []byte(payload),
+			Attempts: int(attempts),
+		})
+	}
+	return jobs, nil
+}
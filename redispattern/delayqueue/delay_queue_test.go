@@ -0,0 +1,144 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xiaojiaoyu100/lizard/redispattern/fakerediser"
+)
+
+func newTestQueue(t *testing.T, c *fakerediser.Client, setters ...Setter) *DelayQueue {
+	q, err := New(c, t.Name(), setters...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+// poll polls q and fails unless it delivers the job id with attempts.
+func poll(t *testing.T, q *DelayQueue, id string, attempts int) {
+	t.Helper()
+	job, err := q.Poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil {
+		t.Fatalf("poll: no job, want %s", id)
+	}
+	if job.ID != id || string(job.Payload) != "payload" || job.Attempts != attempts {
+		t.Fatalf("poll: got %s %q %d, want %s %q %d", job.ID, job.Payload, job.Attempts, id, "payload", attempts)
+	}
+}
+
+// dead fails unless the dead letters are exactly the job id with attempts.
+func dead(t *testing.T, q *DelayQueue, id string, attempts int) {
+	t.Helper()
+	jobs, err := q.DeadLetters(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != id || string(jobs[0].Payload) != "payload" || jobs[0].Attempts != attempts {
+		t.Fatalf("dead letters: got %+v, want %s with %d attempts", jobs, id, attempts)
+	}
+}
+
+func TestNackRetries(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	q := newTestQueue(t, c, WithMaxAttempts(3))
+	ctx := context.Background()
+
+	id, err := q.Push(ctx, []byte("payload"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for attempts := 1; attempts <= 3; attempts++ {
+		poll(t, q, id, attempts)
+		if err := q.Nack(ctx, id, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if job, err := q.Poll(ctx); err != nil || job != nil {
+		t.Fatalf("poll after max attempts: got %+v, %v, want nil, nil", job, err)
+	}
+	dead(t, q, id, 3)
+	if err := q.Nack(ctx, id, 0); !IsJobNotFound(err) {
+		t.Fatalf("nack of a dead job: got %v, want job not found", err)
+	}
+}
+
+func TestPollMovesToDead(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	q := newTestQueue(t, c, WithMaxAttempts(2), WithVisibilityTimeout(10*time.Millisecond))
+	ctx := context.Background()
+
+	id, err := q.Push(ctx, []byte("payload"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poll(t, q, id, 1)
+	if job, err := q.Poll(ctx); err != nil || job != nil {
+		t.Fatalf("poll within visibility timeout: got %+v, %v, want nil, nil", job, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	poll(t, q, id, 2)
+	time.Sleep(20 * time.Millisecond)
+	// 未ack的任务超过最大次数.
+	if job, err := q.Poll(ctx); err != nil || job != nil {
+		t.Fatalf("poll after max attempts: got %+v, %v, want nil, nil", job, err)
+	}
+	dead(t, q, id, 2)
+}
+
+func TestRequeue(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	q := newTestQueue(t, c, WithMaxAttempts(1))
+	ctx := context.Background()
+
+	id, err := q.Push(ctx, []byte("payload"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poll(t, q, id, 1)
+	if err := q.Nack(ctx, id, 0); err != nil {
+		t.Fatal(err)
+	}
+	dead(t, q, id, 1)
+
+	if err := q.Requeue(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := q.DeadLetters(ctx, 10); err != nil || len(jobs) != 0 {
+		t.Fatalf("dead letters after requeue: got %+v, %v, want none", jobs, err)
+	}
+	poll(t, q, id, 1)
+	if err := q.Ack(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Requeue(ctx, id); !IsJobNotFound(err) {
+		t.Fatalf("requeue of a live job: got %v, want job not found", err)
+	}
+	if err := q.Ack(ctx, id); !IsJobNotFound(err) {
+		t.Fatalf("second ack: got %v, want job not found", err)
+	}
+}
+
+func TestPushDelay(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	q := newTestQueue(t, c)
+	ctx := context.Background()
+
+	id, err := q.Push(ctx, []byte("payload"), 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, err := q.Poll(ctx); err != nil || job != nil {
+		t.Fatalf("poll before due: got %+v, %v, want nil, nil", job, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	poll(t, q, id, 1)
+}
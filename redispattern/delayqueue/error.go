@@ -0,0 +1,20 @@
+package delayqueue
+
+import "errors"
+
+// Error error
+type Error string
+
+const (
+	errJobNotFound = Error("job not found")
+)
+
+// Error reports an error.
+func (e Error) Error() string {
+	return string(e)
+}
+
+// IsJobNotFound reports a job which is neither pending nor dead, e.g. acked already.
+func IsJobNotFound(err error) bool {
+	return errors.Is(err, errJobNotFound)
+}
@@ -0,0 +1,15 @@
+package delayqueue
+
+import (
+	"github.com/go-redis/redis/v7"
+)
+
+var (
+	_ rediser = (*redis.Client)(nil)
+	_ rediser = (*redis.Ring)(nil)
+	_ rediser = (*redis.ClusterClient)(nil)
+)
+
+type rediser interface {
+	Eval(script string, keys []string, args ...interface{}) *redis.Cmd
+}
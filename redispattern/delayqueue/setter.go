@@ -0,0 +1,38 @@
+package delayqueue
+
+import (
+	"errors"
+	"time"
+)
+
+// Setter configures option.
+type Setter func(o *option) error
+
+type option struct {
+	maxAttempts       int
+	visibilityTimeout time.Duration
+}
+
+// WithMaxAttempts configures how many times a job is delivered before it is
+// moved to the dead letters.
+func WithMaxAttempts(n int) Setter {
+	return func(o *option) error {
+		if n < 1 {
+			return errors.New("max attempts is less than 1")
+		}
+		o.maxAttempts = n
+		return nil
+	}
+}
+
+// WithVisibilityTimeout configures how long a polled job stays hidden from
+// other workers, it is delivered again if it is not acked by then.
+func WithVisibilityTimeout(d time.Duration) Setter {
+	return func(o *option) error {
+		if d <= 0 {
+			return errors.New("visibility timeout is not positive")
+		}
+		o.visibilityTimeout = d
+		return nil
+	}
+}
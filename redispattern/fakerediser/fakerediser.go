@@ -0,0 +1,92 @@
+// Package fakerediser runs the redis commands and Lua scripts of the patterns
+// of redispattern against an in-process miniredis, to unit-test code built on
+// them deterministically without a redis server. The scripts which ship run
+// as they are, interpreted by the Lua of miniredis, so a bug in one fails the
+// tests of its pattern. It is a testing utility, not a redis.
+//
+// Client is a *redis.Client, so pipelines, transactions and pub/sub work as
+// far as miniredis supports them. The clock of miniredis follows the real one
+// in steps of the sweep interval, keys then expire like in redis.
+package fakerediser
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
+)
+
+type option struct {
+	sweepInterval time.Duration
+}
+
+// Setter configures option.
+type Setter func(o *option)
+
+// WithSweepInterval configures how often the clock of miniredis catches up
+// with the real one, expired keys disappear at this granularity.
+func WithSweepInterval(d time.Duration) Setter {
+	return func(o *option) {
+		o.sweepInterval = d
+	}
+}
+
+// Client is a redis client connected to its own miniredis, safe for
+// concurrent use.
+type Client struct {
+	*redis.Client
+	server *miniredis.Miniredis
+	done   chan struct{}
+	once   sync.Once
+}
+
+// New starts a miniredis and returns a Client connected to it, call Close to
+// stop both. It panics if miniredis cannot listen, like httptest.NewServer.
+func New(setters ...Setter) *Client {
+	o := option{
+		sweepInterval: time.Millisecond,
+	}
+	for _, setter := range setters {
+		setter(&o)
+	}
+	server, err := miniredis.Run()
+	if err != nil {
+		panic(fmt.Sprintf("fakerediser: failed to start miniredis: %v", err))
+	}
+	c := &Client{
+		Client: redis.NewClient(&redis.Options{Addr: server.Addr()}),
+		server: server,
+		done:   make(chan struct{}),
+	}
+	go c.tick(o.sweepInterval)
+	return c
+}
+
+// Close closes the client and stops miniredis.
+func (c *Client) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.done)
+		err = c.Client.Close()
+		c.server.Close()
+	})
+	return err
+}
+
+// tick advances the clock of miniredis, which otherwise never expires a key.
+func (c *Client) tick(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	last := time.Now()
+	for {
+		select {
+		case now := <-t.C:
+			c.server.FastForward(now.Sub(last))
+			last = now
+		case <-c.done:
+			return
+		}
+	}
+}
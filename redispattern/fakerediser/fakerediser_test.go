@@ -0,0 +1,79 @@
+package fakerediser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/script"
+)
+
+func TestExpire(t *testing.T) {
+	c := New()
+	defer c.Close()
+
+	c.Set("k", "a", 20*time.Millisecond)
+	if n, _ := c.Exists("k").Result(); n != 1 {
+		t.Fatal("key should exist before its ttl")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if n, _ := c.Exists("k").Result(); n != 0 {
+		t.Fatal("key should expire with the real clock")
+	}
+}
+
+func TestScript(t *testing.T) {
+	c := New()
+	defer c.Close()
+
+	c.Set("k", "a", time.Hour)
+	if n, err := c.Eval(script.LockGuardExtend, []string{"k"}, "a", 10).Int64(); err != nil || n != 1 {
+		t.Fatalf("extend: %d, %v, want: 1, nil", n, err)
+	}
+	if ttl, _ := c.PTTL("k").Result(); ttl <= 0 || ttl > 10*time.Millisecond {
+		t.Errorf("ttl: %s, want at most 10ms", ttl)
+	}
+
+	sha, err := c.ScriptLoad(script.LockGuardDel).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := c.EvalSha(sha, []string{"k"}, "b").Int64(); err != nil || n != 0 {
+		t.Errorf("del of another value: %d, %v, want: 0, nil", n, err)
+	}
+	if err := c.EvalSha("0000", []string{"k"}).Err(); err == nil {
+		t.Error("EvalSha of an unknown digest should fail")
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	c := New()
+	defer c.Close()
+	c.Set("k", "a", time.Hour)
+
+	pipe := c.Pipeline()
+	defer pipe.Close()
+	extend := pipe.Eval(script.LockGuardExtend, []string{"k"}, "a", 10000)
+	missing := pipe.Eval(script.LockGuardExtend, []string{"missing"}, "a", 10000)
+	expire := pipe.Expire("k", time.Minute)
+	if _, err := pipe.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := extend.Int64(); err != nil || n != 1 {
+		t.Errorf("extend: %d, %v, want: 1, nil", n, err)
+	}
+	if n, err := missing.Int64(); err != nil || n != 0 {
+		t.Errorf("extend of a missing key: %d, %v, want: 0, nil", n, err)
+	}
+	if ok, err := expire.Result(); err != nil || !ok {
+		t.Errorf("expire: %t, %v, want: true, nil", ok, err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	c := New()
+	c.Close()
+	c.Close()
+	if err := c.Ping().Err(); err == nil {
+		t.Error("ping after Close should fail")
+	}
+}
@@ -0,0 +1,129 @@
+// Package runner runs a handler while periodically renewing whatever guards it,
+// it is shared by the handler-oriented patterns of redispattern.
+package runner
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Renewal describes how a guard is kept alive while its handler runs.
+type Renewal struct {
+	Interval time.Duration
+	// Jitter shortens every wait by a random fraction in [0, Jitter) of
+	// Interval, so that guards taken at the same time do not renew in lockstep.
+	Jitter float64
+	// Renew reports whether renewal should go on, nil means the guard is
+	// renewed elsewhere and Run starts no renewal goroutine.
+	Renew func() bool
+	// OnPanic, if not nil, is called with the value of a panic in Renew
+	// while it is recovered, so that debug.Stack still shows where it
+	// happened. Renewal stops after it.
+	OnPanic func(value interface{})
+}
+
+func (r Renewal) next() time.Duration {
+	if r.Jitter <= 0 {
+		return r.Interval
+	}
+	return r.Interval - time.Duration(rand.Float64()*r.Jitter*float64(r.Interval))
+}
+
+// PanicError is the error returned for a panic in handler, it unwraps to the
+// panic value if that is an error.
+type PanicError struct {
+	Value interface{}
+}
+
+// Error reports an error.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%+v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Run runs handler in its own goroutine and renews until handler returns or
+// ctx is done. A panic in handler is recovered and returned as a *PanicError, a
+// panic in Renew stops renewal and is reported to OnPanic.
+//
+// release is called exactly once, after renewal has stopped, so a pattern
+// never renews what it has already released. If ctx is done first Run
+// returns ctx.Err() without waiting for handler, which then finishes on its
+// own without blocking.
+func Run(ctx context.Context, renewal Renewal, release func(), handler func(ctx context.Context) error) error {
+	// 带缓冲，ctx先结束时handler协程仍可写入并退出.
+	errChan := make(chan error, 1)
+	stop := make(chan struct{})
+	renewed := make(chan struct{})
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errChan <- &PanicError{Value: r}
+			}
+		}()
+		errChan <- handler(ctx)
+	}()
+
+	if renewal.Renew == nil {
+		close(renewed)
+	} else {
+		go renew(renewal, stop, renewed)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case err = <-errChan:
+	}
+	close(stop)
+	<-renewed
+	release()
+	return err
+}
+
+// renew renews until Renew reports false or stop is closed, then closes renewed.
+func renew(renewal Renewal, stop <-chan struct{}, renewed chan<- struct{}) {
+	defer close(renewed)
+	// Renew may panic, e.g. on a nil or buggy client, stop renewing rather than crash.
+	defer func() {
+		if r := recover(); r != nil && renewal.OnPanic != nil {
+			renewal.OnPanic(r)
+		}
+	}()
+	t := time.NewTimer(renewal.next())
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if !renewal.Renew() {
+				return
+			}
+			t.Reset(renewal.next())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Inline runs handler on the calling goroutine without renewal, for guards
+// whose ttl outlives handler. It spends no goroutine, channel or timer, a
+// panic in handler is recovered and returned as an error like in Run and
+// release is called exactly once. Unlike Run it cannot return before handler
+// does when ctx is done, handler must watch ctx itself.
+func Inline(ctx context.Context, release func(), handler func(ctx context.Context) error) (err error) {
+	defer release()
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r}
+		}
+	}()
+	return handler(ctx)
+}
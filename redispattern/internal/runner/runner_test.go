@@ -0,0 +1,125 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunReleasesAfterRenewal(t *testing.T) {
+	var (
+		renewing int32
+		renews   int32
+		released int32
+	)
+	renew := func() bool {
+		atomic.StoreInt32(&renewing, 1)
+		time.Sleep(2 * time.Millisecond)
+		atomic.AddInt32(&renews, 1)
+		atomic.StoreInt32(&renewing, 0)
+		return true
+	}
+	release := func() {
+		if atomic.LoadInt32(&renewing) == 1 {
+			t.Error("release while renewing")
+		}
+		atomic.AddInt32(&released, 1)
+	}
+	renewal := Renewal{Interval: time.Millisecond, Renew: renew}
+	err := Run(context.Background(), renewal, release, func(ctx context.Context) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := atomic.LoadInt32(&renews)
+	time.Sleep(10 * time.Millisecond)
+	if got := atomic.LoadInt32(&renews); got != n {
+		t.Errorf("renewed %d times after Run returned", got-n)
+	}
+	if released != 1 {
+		t.Errorf("released: %d, want: 1", released)
+	}
+}
+
+func TestRunRecoversPanic(t *testing.T) {
+	boom := errors.New("boom")
+	renewal := Renewal{Interval: time.Second, Renew: func() bool { return true }}
+	err := Run(context.Background(), renewal, func() {}, func(ctx context.Context) error {
+		panic(boom)
+	})
+	if !errors.Is(err, boom) {
+		t.Errorf("want: %v, got: %v", boom, err)
+	}
+}
+
+func TestRunDoesNotLeakOnCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		cancel()
+	}()
+	renewal := Renewal{Interval: time.Millisecond, Renew: func() bool { return true }}
+	err := Run(ctx, renewal, func() {}, func(ctx context.Context) error {
+		<-done
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("want: %v, got: %v", context.Canceled, err)
+	}
+	close(done)
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("goroutines: %d, want at most %d", n, before)
+	}
+}
+
+func TestRunSurvivesRenewPanic(t *testing.T) {
+	var (
+		released int32
+		panicked interface{}
+	)
+	err := Run(context.Background(), Renewal{Interval: time.Millisecond, Renew: func() bool {
+		panic("nil client")
+	}, OnPanic: func(value interface{}) {
+		panicked = value
+	}}, func() {
+		atomic.AddInt32(&released, 1)
+	}, func(ctx context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if released != 1 {
+		t.Errorf("released: %d, want: 1", released)
+	}
+	if panicked != "nil client" {
+		t.Errorf("panicked: %v, want the panic reported", panicked)
+	}
+}
+
+func TestInlineRecoversPanic(t *testing.T) {
+	boom := errors.New("boom")
+	released := 0
+	err := Inline(context.Background(), func() { released++ }, func(ctx context.Context) error {
+		panic(boom)
+	})
+	if !errors.Is(err, boom) {
+		t.Errorf("want: %v, got: %v", boom, err)
+	}
+	if released != 1 {
+		t.Errorf("released: %d, want: 1", released)
+	}
+}
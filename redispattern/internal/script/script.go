@@ -0,0 +1,372 @@
+// Package script holds the Lua scripts of redispattern so that in-memory
+// backends can recognise and emulate them.
+package script
+
+// LockGuardDel deletes KEYS[1] only if it still holds ARGV[1].
+const LockGuardDel = `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+else
+	return 0
+end`
+
+// LockGuardExtend sets the ttl of KEYS[1] to ARGV[2] milliseconds only if it
+// still holds ARGV[1].
+const LockGuardExtend = `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+else
+	return 0
+end`
+
+// LockGuardExtendEpoch is LockGuardExtend refusing with -1 when the epoch
+// counter at KEYS[2] is below ARGV[3], the epoch taken with the lock.
+const LockGuardExtendEpoch = `
+if tonumber(redis.call("get", KEYS[2]) or 0) < tonumber(ARGV[3]) then
+	return -1
+end
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+else
+	return 0
+end`
+
+// The RWLock scripts keep the holders of KEYS[1] in a sorted set scored by
+// their last renewal in milliseconds, readers as "r:" .. id and the writer as
+// "w:" .. id. Holders whose score is older than the ttl are pruned first.
+// ARGV[1] is the holder id, ARGV[2] the current time and ARGV[3] the ttl.
+
+// RWLockRead adds a reader unless another holder writes.
+const RWLockRead = `
+local key = KEYS[1]
+local id = ARGV[1]
+local now = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+
+redis.call("zremrangebyscore", key, "-inf", now - ttl)
+
+for _, member in ipairs(redis.call("zrange", key, 0, -1)) do
+	if string.sub(member, 1, 2) == "w:" and member ~= "w:" .. id then
+		return 0
+	end
+end
+
+redis.call("zadd", key, now, "r:" .. id)
+redis.call("pexpire", key, ttl)
+return 1
+`
+
+// RWLockWrite adds the writer if there is no other holder.
+const RWLockWrite = `
+local key = KEYS[1]
+local id = ARGV[1]
+local now = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+
+redis.call("zremrangebyscore", key, "-inf", now - ttl)
+
+local n = redis.call("zcard", key)
+if n == 0 or (n == 1 and redis.call("zscore", key, "w:" .. id)) then
+	redis.call("zadd", key, now, "w:" .. id)
+	redis.call("pexpire", key, ttl)
+	return 1
+end
+
+return 0
+`
+
+// RWLockUpgrade turns the read hold of id into the write hold if it is the
+// only holder.
+const RWLockUpgrade = `
+local key = KEYS[1]
+local id = ARGV[1]
+local now = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+
+redis.call("zremrangebyscore", key, "-inf", now - ttl)
+
+if redis.call("zcard", key) == 1 and redis.call("zscore", key, "r:" .. id) then
+	redis.call("zrem", key, "r:" .. id)
+	redis.call("zadd", key, now, "w:" .. id)
+	redis.call("pexpire", key, ttl)
+	return 1
+end
+
+return 0
+`
+
+// RWLockRenew refreshes the score of the member ARGV[1] if it still holds.
+const RWLockRenew = `
+local key = KEYS[1]
+local member = ARGV[1]
+local now = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+
+if redis.call("zscore", key, member) then
+	redis.call("zadd", key, now, member)
+	redis.call("pexpire", key, ttl)
+	return 1
+end
+
+return 0
+`
+
+// RWLockRelease removes the member ARGV[1].
+const RWLockRelease = `
+return redis.call("zrem", KEYS[1], ARGV[1])
+`
+
+// LockGuardTransfer sets KEYS[1] to ARGV[2] with a ttl of ARGV[3]
+// milliseconds only if it still holds ARGV[1].
+const LockGuardTransfer = `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	redis.call("set", KEYS[1], ARGV[2], "PX", ARGV[3])
+	return 1
+else
+	return 0
+end`
+
+// LockGuardJoinWait counts a waiter in KEYS[1] unless ARGV[1] are counted
+// already, the count expires ARGV[2] milliseconds after the last waiter joined.
+const LockGuardJoinWait = `
+if tonumber(redis.call("get", KEYS[1]) or 0) >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("incr", KEYS[1])
+redis.call("pexpire", KEYS[1], ARGV[2])
+return 1`
+
+// LockGuardLeaveWait uncounts a waiter from KEYS[1].
+const LockGuardLeaveWait = `
+if redis.call("decr", KEYS[1]) <= 0 then
+	redis.call("del", KEYS[1])
+end
+return 1`
+
+// LockGuardAcquireOrGet sets KEYS[1] to ARGV[1] with a ttl of ARGV[2]
+// milliseconds if it does not exist and returns 1, otherwise it returns the
+// value KEYS[1] holds.
+const LockGuardAcquireOrGet = `
+if redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return redis.call("get", KEYS[1])`
+
+// SemaphoreAcquire adds the holder ARGV[3] scored by the current time ARGV[2]
+// to the sorted set KEYS[1] if it holds fewer than ARGV[1], after pruning the
+// holders older than the ttl ARGV[4].
+const SemaphoreAcquire = `
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local now = tonumber(ARGV[2])
+local id = ARGV[3]
+local ttl = tonumber(ARGV[4])
+
+redis.call("zremrangebyscore", key, "-inf", now - ttl)
+
+if redis.call("zcard", key) < limit then
+	redis.call("zadd", key, now, id)
+	redis.call("pexpire", key, ttl)
+	return 1
+end
+
+return 0
+`
+
+// SemaphoreRenew refreshes the score of the holder ARGV[2] if it still holds.
+const SemaphoreRenew = `
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local id = ARGV[2]
+local ttl = tonumber(ARGV[3])
+
+if redis.call("zscore", key, id) then
+	redis.call("zadd", key, now, id)
+	redis.call("pexpire", key, ttl)
+	return 1
+end
+
+return 0
+`
+
+// SemaphoreRelease removes the holder ARGV[1], it is the same as RWLockRelease.
+const SemaphoreRelease = RWLockRelease
+
+// tokenBucketRefill loads the bucket at KEYS[1] of ARGV[2] tokens refilled
+// one per ARGV[1] milliseconds into obj, refilled up to the current time
+// ARGV[3], for ARGV[4] tokens to be taken and stored for ARGV[5] seconds.
+const tokenBucketRefill = `
+local key = KEYS[1]
+local rate = tonumber(ARGV[1])
+local tokenNum = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local num = tonumber(ARGV[4])
+local expiration = ARGV[5]
+local obj = {
+tn=tokenNum,
+ts=now
+}
+
+local value = redis.call("get", key)
+if value then
+  obj = cjson.decode(value)
+  -- ts is stored as a string to keep its precision.
+  obj.ts = tonumber(obj.ts)
+end
+
+local incr = math.floor((now - obj.ts) / rate)
+if incr > 0 then
+  obj.tn = math.min(obj.tn + incr, tokenNum)
+  obj.ts = obj.ts + incr * rate
+end
+`
+
+// TokenBucketConsume takes ARGV[4] tokens from the bucket at KEYS[1] of
+// ARGV[2] tokens refilled one per ARGV[1] milliseconds, ARGV[3] being the
+// current time and ARGV[5] the expiration in seconds. It returns 1 if taken.
+const TokenBucketConsume = tokenBucketRefill + `
+if obj.tn >= num then
+  obj.tn = obj.tn - num
+  obj.ts = string.format("%.f", obj.ts)
+  if redis.call("set", key, cjson.encode(obj), "EX", expiration) then
+    return 1
+  end
+end
+
+return 0
+`
+
+// TokenBucketTakeN is TokenBucketConsume returning {1, 0} on success and
+// {0, wait} on denial, wait being the milliseconds until num tokens are in the bucket.
+const TokenBucketTakeN = tokenBucketRefill + `
+if obj.tn >= num then
+  obj.tn = obj.tn - num
+  obj.ts = string.format("%.f", obj.ts)
+  redis.call("set", key, cjson.encode(obj), "EX", expiration)
+  return {1, 0}
+end
+
+-- the next token is due at ts + rate, the missing ones follow every rate.
+return {0, (num - obj.tn) * rate - (now - obj.ts)}
+`
+
+// OnceRenew extends the lease of the executor ARGV[1] to ARGV[2]
+// milliseconds, it is the same as LockGuardExtend.
+const OnceRenew = LockGuardExtend
+
+// OnceStore sets KEYS[1] to ARGV[2] with a ttl of ARGV[3] milliseconds, zero
+// meaning none, only if it still holds the lease ARGV[1].
+const OnceStore = `
+if redis.call("get", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("set", KEYS[1], ARGV[2], "PX", ARGV[3])
+else
+	redis.call("set", KEYS[1], ARGV[2])
+end
+return 1`
+
+// OnceRelease gives up the lease ARGV[1], it is the same as LockGuardDel.
+const OnceRelease = LockGuardDel
+
+// LatchArrive counts down the latch at KEYS[1] unless it reached zero,
+// publishing to ARGV[1] on reaching it. It returns the count left.
+const LatchArrive = `
+local left = tonumber(redis.call("get", KEYS[1]) or "0")
+if left <= 0 then
+	return 0
+end
+
+left = redis.call("decr", KEYS[1])
+if left == 0 then
+	redis.call("publish", ARGV[1], "0")
+end
+
+return left
+`
+
+// The DelayQueue scripts keep the jobs of a queue in KEYS[1], the sorted set
+// of pending jobs scored by their due time in milliseconds, KEYS[2], the hash
+// of payloads, KEYS[3], the hash of delivery attempts, and KEYS[4], the list
+// of dead letters.
+
+// DelayQueuePush adds the job ARGV[1] with the payload ARGV[2] due at ARGV[3].
+const DelayQueuePush = `
+redis.call("hset", KEYS[2], ARGV[1], ARGV[2])
+redis.call("zadd", KEYS[1], ARGV[3], ARGV[1])
+return 1
+`
+
+// DelayQueuePoll delivers the next job due at ARGV[1], hiding it for ARGV[2]
+// milliseconds, as {id, payload, attempts}. Jobs delivered ARGV[3] times
+// already are moved to the dead letters instead.
+const DelayQueuePoll = `
+local now = tonumber(ARGV[1])
+local visibility = tonumber(ARGV[2])
+local max = tonumber(ARGV[3])
+
+while true do
+	local ids = redis.call("zrangebyscore", KEYS[1], "-inf", now, "LIMIT", 0, 1)
+	if #ids == 0 then
+		return false
+	end
+	local id = ids[1]
+	if tonumber(redis.call("hget", KEYS[3], id) or 0) >= max then
+		redis.call("zrem", KEYS[1], id)
+		redis.call("rpush", KEYS[4], id)
+	else
+		local n = redis.call("hincrby", KEYS[3], id, 1)
+		redis.call("zadd", KEYS[1], now + visibility, id)
+		return {id, redis.call("hget", KEYS[2], id), n}
+	end
+end
+`
+
+// DelayQueueAck removes the job ARGV[1].
+const DelayQueueAck = `
+local n = redis.call("zrem", KEYS[1], ARGV[1])
+redis.call("hdel", KEYS[2], ARGV[1])
+redis.call("hdel", KEYS[3], ARGV[1])
+return n
+`
+
+// DelayQueueNack makes the job ARGV[1] due at ARGV[2], or moves it to the dead
+// letters if it was delivered ARGV[3] times. It returns -1 if it is not pending.
+const DelayQueueNack = `
+local id = ARGV[1]
+local due = tonumber(ARGV[2])
+local max = tonumber(ARGV[3])
+
+if not redis.call("zscore", KEYS[1], id) then
+	return -1
+end
+if tonumber(redis.call("hget", KEYS[3], id) or 0) >= max then
+	redis.call("zrem", KEYS[1], id)
+	redis.call("rpush", KEYS[4], id)
+	return 0
+end
+redis.call("zadd", KEYS[1], due, id)
+return 1
+`
+
+// DelayQueueDead returns the first ARGV[1] dead letters as flat triples.
+const DelayQueueDead = `
+local jobs = {}
+for _, id in ipairs(redis.call("lrange", KEYS[4], 0, tonumber(ARGV[1]) - 1)) do
+	table.insert(jobs, id)
+	table.insert(jobs, redis.call("hget", KEYS[2], id) or "")
+	table.insert(jobs, tonumber(redis.call("hget", KEYS[3], id) or 0))
+end
+return jobs
+`
+
+// DelayQueueRequeue moves the dead job ARGV[1] back, due at ARGV[2].
+const DelayQueueRequeue = `
+if redis.call("lrem", KEYS[4], 1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call("hdel", KEYS[3], ARGV[1])
+redis.call("zadd", KEYS[1], ARGV[2], ARGV[1])
+return 1
+`
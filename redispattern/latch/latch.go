@@ -0,0 +1,158 @@
+package latch
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/script"
+)
+
+const arriveScript = script.LatchArrive
+
+type option struct {
+	expiration   time.Duration
+	pollInterval time.Duration
+}
+
+// Setter configures option.
+type Setter func(o *option) error
+
+// WithExpiration configures how long the counter lives.
+func WithExpiration(d time.Duration) Setter {
+	return func(o *option) error {
+		if d <= 0 {
+			return errors.New("expiration is not positive")
+		}
+		o.expiration = d
+		return nil
+	}
+}
+
+// WithPollInterval configures how often Wait checks the counter in case
+// the release message is missed.
+func WithPollInterval(d time.Duration) Setter {
+	return func(o *option) error {
+		if d <= 0 {
+			return errors.New("poll interval is not positive")
+		}
+		o.pollInterval = d
+		return nil
+	}
+}
+
+// CountDownLatch 分布式倒计时门闩，计数归零时同时释放所有等待者.
+type CountDownLatch struct {
+	redis     rediser
+	subscribe func(channels ...string) subscription
+	key       string
+	channel   string
+	count     int64
+	option    option
+}
+
+// New 生成门闩，计数器在Arm或第一次Arrive时以count初始化.
+func New(redis rediser, key string, count int64, setters ...Setter) (*CountDownLatch, error) {
+	if key == "" {
+		return nil, errors.New("key length is zero")
+	}
+	if count < 1 {
+		return nil, errors.New("count is less than 1")
+	}
+	o := option{
+		expiration:   time.Hour,
+		pollInterval: time.Second,
+	}
+	for _, setter := range setters {
+		if err := setter(&o); err != nil {
+			return nil, err
+		}
+	}
+	return &CountDownLatch{
+		redis: redis,
+		subscribe: func(channels ...string) subscription {
+			return redis.Subscribe(channels...)
+		},
+		key:     key,
+		channel: key + ":released",
+		count:   count,
+		option:  o,
+	}, nil
+}
+
+// Arm creates the counter with count unless it exists. Wait treats a missing
+// counter as released, so arm the latch before its waiters may start, e.g.
+// in the process coordinating them; the first Arrive also arms it.
+func (l *CountDownLatch) Arm() error {
+	return l.redis.SetNX(l.key, l.count, l.option.expiration).Err()
+}
+
+// Arrive counts down and returns how many arrivals are still expected,
+// the arrival reaching zero publishes the release to all waiters.
+func (l *CountDownLatch) Arrive() (int64, error) {
+	if err := l.Arm(); err != nil {
+		return 0, err
+	}
+	return l.redis.Eval(arriveScript, []string{l.key}, l.channel).Int64()
+}
+
+// Wait blocks until the count reaches zero or ctx is done. It subscribes
+// before reading the counter, so a waiter coming after the release still
+// observes the already-zero state, and polls in case a message is lost. A
+// missing counter, not armed yet or expired, counts as released, see Arm.
+func (l *CountDownLatch) Wait(ctx context.Context) error {
+	sub := l.subscribe(l.channel)
+	defer sub.Close()
+	// 等待订阅确认，Close会打断阻塞中的Receive.
+	subscribed := make(chan error, 1)
+	go func() {
+		_, err := sub.Receive()
+		subscribed <- err
+	}()
+	select {
+	case err := <-subscribed:
+		if err != nil {
+			return err
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	t := time.NewTicker(l.option.pollInterval)
+	defer t.Stop()
+	ch := sub.Channel()
+	for {
+		released, err := l.released()
+		if err != nil {
+			return err
+		}
+		if released {
+			return nil
+		}
+		select {
+		case <-ch:
+			return nil
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *CountDownLatch) released() (bool, error) {
+	v, err := l.redis.Get(l.key).Result()
+	if err == redis.Nil {
+		// 计数器已过期，视为已释放，避免等待者永远阻塞.
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return false, err
+	}
+	return n <= 0, nil
+}
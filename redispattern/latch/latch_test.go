@@ -0,0 +1,225 @@
+package latch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/fakerediser"
+)
+
+// readySubscription closes ready once Wait has subscribed.
+type readySubscription struct {
+	subscription
+	ready chan struct{}
+}
+
+func (s readySubscription) Channel() <-chan *redis.Message {
+	defer close(s.ready)
+	return s.subscription.Channel()
+}
+
+// blockedSubscription is never confirmed until closed.
+type blockedSubscription struct {
+	closed chan struct{}
+}
+
+func (s blockedSubscription) Receive() (interface{}, error) {
+	<-s.closed
+	return nil, errors.New("closed")
+}
+
+func (s blockedSubscription) Channel() <-chan *redis.Message {
+	return nil
+}
+
+func (s blockedSubscription) Close() error {
+	close(s.closed)
+	return nil
+}
+
+// silentSubscription never delivers a message, Wait then relies on polling.
+type silentSubscription struct {
+	ch chan *redis.Message
+}
+
+func (s silentSubscription) Receive() (interface{}, error) {
+	return nil, nil
+}
+
+func (s silentSubscription) Channel() <-chan *redis.Message {
+	return s.ch
+}
+
+func (s silentSubscription) Close() error {
+	return nil
+}
+
+func newTestLatch(t *testing.T, c *fakerediser.Client, key string, count int64, setters ...Setter) *CountDownLatch {
+	setters = append(setters, WithPollInterval(5*time.Millisecond))
+	l, err := New(c, key, count, setters...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.subscribe = func(channels ...string) subscription {
+		return silentSubscription{ch: make(chan *redis.Message)}
+	}
+	return l
+}
+
+func TestCountDown(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	l := newTestLatch(t, c, "latch:countdown", 3)
+	if err := l.Arm(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Wait(context.Background())
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := l.Arrive(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	select {
+	case err := <-done:
+		t.Fatalf("Wait returned before the count reached zero: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if left, err := l.Arrive(); err != nil || left != 0 {
+		t.Fatalf("left: %d, err: %v, want: 0", left, err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait should return once the count reaches zero")
+	}
+	if left, _ := l.Arrive(); left != 0 {
+		t.Errorf("left: %d, arrivals after zero should not count", left)
+	}
+}
+
+func TestWaitAfterExpiry(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	l := newTestLatch(t, c, "latch:expired", 2, WithExpiration(10*time.Millisecond))
+	if err := l.Arm(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := l.Wait(ctx); err != nil {
+		t.Fatalf("a late waiter should be released, got: %v", err)
+	}
+	if n, _ := c.Exists("latch:expired").Result(); n != 0 {
+		t.Error("Wait should not re-create the counter")
+	}
+}
+
+func TestWaitCancelled(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	l := newTestLatch(t, c, "latch:cancelled", 2)
+	if err := l.Arm(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("want: %v, got: %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestWaitReleasedByMessage(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	// 轮询间隔很长，Wait只能因订阅收到的消息返回.
+	l, err := New(c, "latch:message", 2, WithPollInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Arm(); err != nil {
+		t.Fatal(err)
+	}
+	ready := make(chan struct{})
+	l.subscribe = func(channels ...string) subscription {
+		return readySubscription{subscription: c.Subscribe(channels...), ready: ready}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Wait(context.Background())
+	}()
+	<-ready
+	// 计数器仍为2，只有发布的消息能释放等待者.
+	if err := c.Publish(l.channel, "released").Err(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait should return once the release message is delivered")
+	}
+}
+
+func TestArriveReleasesSubscriber(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	l, err := New(c, "latch:subscriber", 1, WithPollInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Arm(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Wait(context.Background())
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if left, err := l.Arrive(); err != nil || left != 0 {
+		t.Fatalf("left: %d, err: %v, want: 0", left, err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait should return once the last arrival publishes")
+	}
+}
+
+func TestWaitCancelledBeforeSubscribed(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	l := newTestLatch(t, c, "latch:unsubscribed", 2)
+	l.subscribe = func(channels ...string) subscription {
+		return blockedSubscription{closed: make(chan struct{})}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("want: %v, got: %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,29 @@
+package latch
+
+import (
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+var (
+	_ rediser = (*redis.Client)(nil)
+	_ rediser = (*redis.Ring)(nil)
+	_ rediser = (*redis.ClusterClient)(nil)
+)
+
+type rediser interface {
+	SetNX(key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	Get(key string) *redis.StringCmd
+	Eval(script string, keys []string, args ...interface{}) *redis.Cmd
+	Subscribe(channels ...string) *redis.PubSub
+}
+
+var _ subscription = (*redis.PubSub)(nil)
+
+// subscription is the part of *redis.PubSub used by Wait.
+type subscription interface {
+	Receive() (interface{}, error)
+	Channel() <-chan *redis.Message
+	Close() error
+}
@@ -0,0 +1,14 @@
+package lockguard
+
+import "context"
+
+// lockKeyKey is the context key of the lock key, unexported so that no other
+// package can store or shadow a value under it.
+type lockKeyKey struct{}
+
+// KeyFromContext returns the key of the lock a handler runs under, so that one
+// handler can serve many keys and still tell them apart, e.g. in its logs.
+func KeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(lockKeyKey{}).(string)
+	return key, ok
+}
@@ -0,0 +1,31 @@
+package lockguard
+
+import (
+	"context"
+	"testing"
+)
+
+func TestKeyFromContext(t *testing.T) {
+	handler := func(ctx context.Context) error {
+		key, ok := KeyFromContext(ctx)
+		if !ok {
+			t.Error("no key in context")
+		}
+		if key != "lockguard:a" && key != "lockguard:b" {
+			t.Errorf("key: %s, want one of the lock keys", key)
+		}
+		return nil
+	}
+	for _, key := range []string{"lockguard:a", "lockguard:b"} {
+		guard, err := New(newStubRediser(true), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := guard.Run(context.Background(), handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := KeyFromContext(context.Background()); ok {
+		t.Error("key found in a context without one")
+	}
+}
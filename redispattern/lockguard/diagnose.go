@@ -0,0 +1,171 @@
+package lockguard
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xiaojiaoyu100/lizard/timekit"
+)
+
+const (
+	diagnosePrefix = "lockguard:diagnose:"
+	diagnoseTTL    = 10 * time.Second
+)
+
+// Feature is a redis command probed by Diagnose.
+type Feature struct {
+	Name      string
+	Required  bool // needed by Run, the others only by some options and helpers
+	Supported bool
+	Skipped   bool  // not probed as its setup failed, Supported is false then
+	Err       error // why it is not supported or skipped
+}
+
+// DiagnosticReport lists the features probed by Diagnose.
+type DiagnosticReport struct {
+	Features []Feature
+}
+
+// Unsupported returns the names of the features probed and not supported,
+// required or not.
+func (r DiagnosticReport) Unsupported() []string {
+	var names []string
+	for _, f := range r.Features {
+		if !f.Supported && !f.Skipped {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// Skipped returns the names of the features not probed.
+func (r DiagnosticReport) Skipped() []string {
+	var names []string
+	for _, f := range r.Features {
+		if f.Skipped {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// Diagnose probes the redis commands lockguard relies on, each with a
+// short-lived key of its own so that one missing command does not fail the
+// probes of the others, to fail fast at startup on deployments which lack
+// some, e.g. proxies refusing EVAL. EVAL runs the scripts acquiring and
+// extending a lock, the latter calling PEXPIRE, so its support means both
+// work. EXPIRE is probed on a key set by SET NX and reported as skipped if
+// that fails. The optional INCR, PTTL and SCAN are needed by
+// WithFencingToken and WithEpochCheck, by WithTTLCheck and Inspect and by
+// ListLocks respectively; lockguard relies on no pub/sub.
+//
+// It returns an error satisfying IsUnsupported if a required feature is
+// missing, or the context error if ctx ends first; the report is complete in
+// the first case only.
+func Diagnose(ctx context.Context, redis rediser) (DiagnosticReport, error) {
+	var report DiagnosticReport
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return report, err
+	}
+	prefix := diagnosePrefix + hex.EncodeToString(b) + ":"
+	ttl := timekit.DurationToMillis(diagnoseTTL)
+	// 每个探测使用自己的key，值即key.
+	setNX := func(key string) error {
+		ok, err := redis.SetNX(key, key, diagnoseTTL).Result()
+		if err == nil && !ok {
+			err = fmt.Errorf("key %s exists", key)
+		}
+		return err
+	}
+
+	probes := []struct {
+		name     string
+		required bool
+		setup    func(key string) error
+		probe    func(key string) error
+	}{
+		{"SET NX", true, nil, setNX},
+		{"EVAL", true, nil, func(key string) error {
+			if err := expectOne(redis.Eval(acquireOrGetLuaScript, []string{key}, key, ttl).Int64()); err != nil {
+				return err
+			}
+			return expectOne(redis.Eval(extendLuaScript, []string{key}, key, ttl).Int64())
+		}},
+		{"EXPIRE", true, setNX, func(key string) error {
+			ok, err := redis.Expire(key, diagnoseTTL).Result()
+			if err == nil && !ok {
+				err = fmt.Errorf("key %s is missing", key)
+			}
+			return err
+		}},
+		{"INCR", false, nil, func(key string) error {
+			r, ok := redis.(fencer)
+			if !ok {
+				return errUnsupported
+			}
+			if err := r.Incr(key).Err(); err != nil {
+				return err
+			}
+			// 非正的过期时间即删除计数器.
+			return redis.Expire(key, 0).Err()
+		}},
+		{"PTTL", false, nil, func(key string) error {
+			r, ok := redis.(inspector)
+			if !ok {
+				return errUnsupported
+			}
+			return r.PTTL(key).Err()
+		}},
+		{"SCAN", false, nil, func(key string) error {
+			r, ok := redis.(scanner)
+			if !ok {
+				return errUnsupported
+			}
+			return r.Scan(0, globEscape(prefix)+"*", 10).Err()
+		}},
+	}
+
+	var missing []string
+	for _, p := range probes {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		key := prefix + strings.ReplaceAll(strings.ToLower(p.name), " ", "")
+		defer redis.Eval(delLuaScript, []string{key}, key)
+		f := Feature{
+			Name:     p.name,
+			Required: p.required,
+		}
+		if p.setup != nil {
+			if err := p.setup(key); err != nil {
+				f.Skipped = true
+				f.Err = fmt.Errorf("setup: %w", err)
+				report.Features = append(report.Features, f)
+				continue
+			}
+		}
+		f.Err = p.probe(key)
+		f.Supported = f.Err == nil
+		report.Features = append(report.Features, f)
+		if f.Err != nil && p.required {
+			missing = append(missing, p.name)
+		}
+	}
+	if len(missing) > 0 {
+		return report, fmt.Errorf("%s: %w", strings.Join(missing, ", "), errUnsupported)
+	}
+	return report, nil
+}
+
+// expectOne turns a reply other than 1 into an error.
+func expectOne(n int64, err error) error {
+	if err == nil && n != 1 {
+		err = fmt.Errorf("unexpected reply: %d", n)
+	}
+	return err
+}
@@ -0,0 +1,81 @@
+package lockguard
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+)
+
+// noSetNX fails SET NX, e.g. on a proxy refusing it.
+type noSetNX struct {
+	*memrediser.Client
+}
+
+func (r noSetNX) SetNX(key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	return redis.NewBoolResult(false, errors.New("ERR unknown command 'SET'"))
+}
+
+func TestDiagnose(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	noEval := newStubRediser(true)
+	noEval.eval = redis.NewCmdResult(nil, errors.New("ERR unknown command 'EVAL'"))
+
+	tests := [...]struct {
+		Redis           rediser
+		WantErr         bool
+		WantUnsupported []string
+		WantSkipped     []string
+	}{
+		0: {
+			mem,
+			false,
+			nil,
+			nil,
+		},
+		1: {
+			newStubRediser(true),
+			false,
+			[]string{"INCR", "PTTL", "SCAN"},
+			nil,
+		},
+		2: {
+			noEval,
+			true,
+			[]string{"EVAL", "INCR", "PTTL", "SCAN"},
+			nil,
+		},
+		3: {
+			noSetNX{mem},
+			true,
+			[]string{"SET NX"},
+			[]string{"EXPIRE"},
+		},
+	}
+	for i, test := range tests {
+		report, err := Diagnose(context.Background(), test.Redis)
+		if gotErr := IsUnsupported(err); gotErr != test.WantErr {
+			t.Errorf("case: %d, unsupported error: %t, want: %t, err: %v", i, gotErr, test.WantErr, err)
+		}
+		if got := report.Unsupported(); !reflect.DeepEqual(got, test.WantUnsupported) {
+			t.Errorf("case: %d, unsupported: %v, want: %v", i, got, test.WantUnsupported)
+		}
+		if got := report.Skipped(); !reflect.DeepEqual(got, test.WantSkipped) {
+			t.Errorf("case: %d, skipped: %v, want: %v", i, got, test.WantSkipped)
+		}
+	}
+	if keys, _ := mem.Scan(0, diagnosePrefix+"*", 10).Val(); len(keys) != 0 {
+		t.Errorf("probe keys left behind: %v", keys)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Diagnose(ctx, mem); err != context.Canceled {
+		t.Errorf("want: %v, got: %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,72 @@
+package lockguard
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/script"
+)
+
+const (
+	epochKeyPrefix = "lockguard:epoch:"
+
+	extendEpochLuaScript = script.LockGuardExtendEpoch
+)
+
+// epochKey holds the epoch counter of key. It shares the hash slot of key so
+// that one script can read both on redis cluster: the hash tag of key is
+// kept, a key without one becomes the hash tag, see epochKeySupported.
+func epochKey(key string) string {
+	if hasHashTag(key) {
+		return epochKeyPrefix + key
+	}
+	return epochKeyPrefix + "{" + key + "}"
+}
+
+// hasHashTag reports whether redis cluster hashes only a part of key: the
+// part between the first "{" and the first "}" after it, if not empty.
+func hasHashTag(key string) bool {
+	i := strings.Index(key, "{")
+	if i < 0 {
+		return false
+	}
+	j := strings.Index(key[i+1:], "}")
+	return j > 0
+}
+
+// epochKeySupported reports whether epochKey can share the hash slot of key.
+// A key without hash tag is hashed whole, e.g. "a{}b" whose "{}" is empty,
+// and cannot become a hash tag if it contains a "}".
+func epochKeySupported(key string) bool {
+	return hasHashTag(key) || !strings.Contains(key, "}")
+}
+
+// takeEpoch increments the epoch counter once the lock is obtained.
+func (guard *LockGuard) takeEpoch(ctx context.Context) error {
+	if !guard.lock.epochCheck {
+		return nil
+	}
+	r, cancel := guard.client(ctx)
+	defer cancel()
+	epoch, err := r.(fencer).Incr(epochKey(guard.lock.Key)).Result()
+	if err != nil {
+		return fmt.Errorf("key: %s, epoch: %w", guard.lock.Key, err)
+	}
+	guard.epoch = epoch
+	return nil
+}
+
+// extendEpoch is extend refusing if the epoch regressed.
+func (guard *LockGuard) extendEpoch(r rediser, ms int64) (bool, error) {
+	keys := []string{guard.lock.Key, epochKey(guard.lock.Key)}
+	n, err := r.Eval(extendEpochLuaScript, keys, guard.lock.Value, ms, strconv.FormatInt(guard.epoch, 10)).Int64()
+	if err != nil {
+		return false, err
+	}
+	if n == -1 {
+		return false, fmt.Errorf("key: %s, epoch: %d, err: %w", guard.lock.Key, guard.epoch, errEpochRegressed)
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,90 @@
+package lockguard
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+)
+
+func TestEpochKey(t *testing.T) {
+	tests := [...]struct {
+		Key  string
+		Want string
+	}{
+		0: {
+			"order:1",
+			"lockguard:epoch:{order:1}",
+		},
+		1: {
+			"{user:1}:order",
+			"lockguard:epoch:{user:1}:order",
+		},
+		2: {
+			"order{:1",
+			"lockguard:epoch:{order{:1}",
+		},
+	}
+	for _, test := range tests {
+		if got := epochKey(test.Key); got != test.Want {
+			t.Errorf("key: %s, want: %s, got: %s", test.Key, test.Want, got)
+		}
+	}
+}
+
+func TestEpochKeySupported(t *testing.T) {
+	tests := [...]struct {
+		Key  string
+		Want bool
+	}{
+		0: {"order:1", true},
+		1: {"{user:1}:order", true},
+		// 空的hash tag不算，整个key参与hash.
+		2: {"{}:order", false},
+		3: {"{}{user:1}", false},
+		4: {"order}:1", false},
+		5: {"{user:1}:{}", true},
+	}
+	mem := memrediser.New()
+	defer mem.Close()
+	for _, test := range tests {
+		if got := epochKeySupported(test.Key); got != test.Want {
+			t.Errorf("key: %s, want: %t, got: %t", test.Key, test.Want, got)
+		}
+		_, err := New(mem, test.Key, WithEpochCheck())
+		if (err == nil) != test.Want {
+			t.Errorf("key: %s, New err: %v, want supported: %t", test.Key, err, test.Want)
+		}
+	}
+}
+
+func TestWithEpochCheck(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	o := &lostObserver{}
+	guard, err := New(mem, "lockguard:epoch", WithEpochCheck(), WithObserver(o))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = guard.Run(context.Background(), func(ctx context.Context) error {
+		if ok, err := guard.TryExtend(ctx, time.Minute); err != nil || !ok {
+			t.Errorf("extend: %t, %v, want: true, nil", ok, err)
+		}
+		// 模拟故障转移到落后的副本.
+		mem.Del(epochKey("lockguard:epoch"))
+		if _, err := guard.TryExtend(ctx, time.Minute); !IsEpochRegressed(err) {
+			t.Errorf("want epoch regressed, got: %v", err)
+		}
+		if guard.renewTTL() {
+			t.Error("renewal should stop once the epoch regressed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(o.lost) != 1 || !IsEpochRegressed(o.lost[0]) {
+		t.Errorf("lost: %v, want one epoch regressed lock lost event", o.lost)
+	}
+}
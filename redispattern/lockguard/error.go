@@ -1,12 +1,22 @@
 package lockguard
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 // Error error
 type Error string
 
 const (
 	errLockNotObtained = Error("lock not obtained")
+	errLockLost        = Error("lock lost")
+	errUnsupported     = Error("redis command not supported")
+	errNotLocked       = Error("not locked")
+	errEpochRegressed  = Error("epoch regressed")
+	errTooManyWaiters  = Error("too many waiters")
+	errHandlerTimeout  = Error("handler timeout")
 )
 
 // Error reports an error.
@@ -18,3 +28,108 @@ func (e Error) Error() string {
 func IsLockNotObtained(err error) bool {
 	return errors.Is(err, errLockNotObtained)
 }
+
+// IsUnsupported reports a redis client or server lacking a command, see Diagnose.
+func IsUnsupported(err error) bool {
+	return errors.Is(err, errUnsupported)
+}
+
+// IsNotLocked reports a key which is not locked.
+func IsNotLocked(err error) bool {
+	return errors.Is(err, errNotLocked)
+}
+
+// IsEpochRegressed reports that the epoch counter of a lock went below the
+// epoch taken with it, a sign of a failover to a replica that was behind.
+func IsEpochRegressed(err error) bool {
+	return errors.Is(err, errEpochRegressed)
+}
+
+// IsTooManyWaiters reports a lock given up on without waiting, see WithMaxWaiters.
+func IsTooManyWaiters(err error) bool {
+	return errors.Is(err, errTooManyWaiters)
+}
+
+// IsHandlerTimeout reports a handler cancelled by WithHandlerTimeout, as
+// opposed to a done context of the caller.
+func IsHandlerTimeout(err error) bool {
+	return errors.Is(err, errHandlerTimeout)
+}
+
+// NotObtainedError reports a lock which is not obtained after Attempts tries
+// within Elapsed, errors.Is(err, errLockNotObtained) holds for it.
+type NotObtainedError struct {
+	Key      string
+	Attempts int
+	Elapsed  time.Duration
+}
+
+// Error reports an error.
+func (e *NotObtainedError) Error() string {
+	return fmt.Sprintf("key: %s, attempts: %d, elapsed: %s, err: %s", e.Key, e.Attempts, e.Elapsed, errLockNotObtained)
+}
+
+// Unwrap returns errLockNotObtained.
+func (e *NotObtainedError) Unwrap() error {
+	return errLockNotObtained
+}
+
+// HandlerError reports the failure of the handler of Run, Panicked tells a
+// recovered panic from a returned error. errors.Is and errors.As see through
+// it to the returned error or the panic value if it is an error, Unlock holds
+// the *UnlockError if releasing the lock failed as well.
+type HandlerError struct {
+	Err      error
+	Panicked bool
+	Unlock   error
+}
+
+// Error reports an error.
+func (e *HandlerError) Error() string {
+	msg := e.Err.Error()
+	if e.Panicked {
+		msg = "handler panicked: " + msg
+	}
+	if e.Unlock != nil {
+		msg += ", " + e.Unlock.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the error of the handler.
+func (e *HandlerError) Unwrap() error {
+	return e.Err
+}
+
+// RenewPanicError reports a panic recovered while renewing the lock, Value is
+// the recovered value. The lock is then reported lost, errors.Is(err,
+// errLockLost) holds for it.
+type RenewPanicError struct {
+	Value interface{}
+}
+
+// Error reports an error.
+func (e *RenewPanicError) Error() string {
+	return fmt.Sprintf("renewal panicked: %+v: %s", e.Value, errLockLost)
+}
+
+// Unwrap returns errLockLost.
+func (e *RenewPanicError) Unwrap() error {
+	return errLockLost
+}
+
+// UnlockError reports a lock which could not be released, it expires on its own.
+type UnlockError struct {
+	Key string
+	Err error
+}
+
+// Error reports an error.
+func (e *UnlockError) Error() string {
+	return fmt.Sprintf("key: %s, unlock: %v", e.Key, e.Err)
+}
+
+// Unwrap returns the error of redis.
+func (e *UnlockError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,45 @@
+package lockguard
+
+import (
+	"context"
+	"fmt"
+)
+
+const fenceKeyPrefix = "lockguard:fence:"
+
+// fenceKey holds the counter of key, it never expires so tokens only grow.
+func fenceKey(key string) string {
+	return fenceKeyPrefix + key
+}
+
+// tokenKey is the context key of the fencing token. It is unexported, so no
+// other package can store or shadow a value under it.
+type tokenKey struct{}
+
+// TokenFromContext returns the fencing token put into the handler context by
+// a LockGuard created with WithFencingToken.
+func TokenFromContext(ctx context.Context) (int64, bool) {
+	token, ok := ctx.Value(tokenKey{}).(int64)
+	return token, ok
+}
+
+// Token returns the fencing token of the current Run, zero if there is none.
+func (guard *LockGuard) Token() int64 {
+	return guard.token
+}
+
+// fence takes the next fencing token once the lock is obtained and derives
+// the handler context carrying it.
+func (guard *LockGuard) fence(ctx context.Context) (context.Context, error) {
+	if !guard.lock.fencing {
+		return ctx, nil
+	}
+	r, cancel := guard.client(ctx)
+	defer cancel()
+	token, err := r.(fencer).Incr(fenceKey(guard.lock.Key)).Result()
+	if err != nil {
+		return ctx, fmt.Errorf("key: %s, fencing token: %w", guard.lock.Key, err)
+	}
+	guard.token = token
+	return context.WithValue(ctx, tokenKey{}, token), nil
+}
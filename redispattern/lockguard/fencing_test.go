@@ -0,0 +1,49 @@
+package lockguard
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+)
+
+func TestTokenFromContext(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+
+	guard, err := New(mem, "lockguard:fence", WithFencingToken())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tokens []int64
+	for i := 0; i < 2; i++ {
+		err := guard.Run(context.Background(), func(ctx context.Context) error {
+			token, ok := TokenFromContext(ctx)
+			if !ok {
+				return errors.New("no token in context")
+			}
+			if token != guard.Token() {
+				t.Errorf("context token: %d, guard token: %d", token, guard.Token())
+			}
+			tokens = append(tokens, token)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(tokens) != 2 || tokens[1] <= tokens[0] {
+		t.Errorf("tokens: %v, want increasing", tokens)
+	}
+	if _, ok := TokenFromContext(context.Background()); ok {
+		t.Error("token found in a context without one")
+	}
+}
+
+func TestWithFencingTokenUnsupported(t *testing.T) {
+	_, err := New(newStubRediser(true), "lockguard:fence", WithFencingToken())
+	if !errors.Is(err, errUnsupported) {
+		t.Errorf("want: %v, got: %v", errUnsupported, err)
+	}
+}
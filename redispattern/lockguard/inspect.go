@@ -0,0 +1,184 @@
+package lockguard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// ownerSeparator ends the owner metadata at the head of a lock value,
+// encoding/json never writes a raw newline.
+const ownerSeparator = "\n"
+
+// Owner describes who holds a lock. It is stored at the head of the lock
+// value itself, so it lives and dies with the lock and costs no extra key.
+type Owner struct {
+	TraceID    string `json:"trace_id,omitempty"`
+	InstanceID string `json:"instance_id,omitempty"` // see WithInstanceID
+}
+
+func (o Owner) empty() bool {
+	return o == Owner{}
+}
+
+// LockInfo describes a held lock.
+type LockInfo struct {
+	Key   string
+	TTL   time.Duration // negative if the lock never expires
+	Owner *Owner        // nil if the holder stored no metadata
+}
+
+// attachOwner prefixes the lock value with the owner metadata of this Run.
+// A value given by WithValue is kept as is.
+func (guard *LockGuard) attachOwner(ctx context.Context) error {
+	if guard.lock.providedValue != "" {
+		return nil
+	}
+	o := Owner{InstanceID: guard.lock.instanceID}
+	if guard.lock.traceIDFunc != nil {
+		o.TraceID = guard.lock.traceIDFunc(ctx)
+	}
+	if o.empty() {
+		return nil
+	}
+	b, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	guard.setValue(string(b) + ownerSeparator + guard.lock.Value)
+	return nil
+}
+
+// ParseOwner returns the owner metadata at the head of a lock value, nil if it
+// has none, e.g. to decode the holder returned by TryLockOrOwner.
+func ParseOwner(value string) *Owner {
+	if !strings.HasPrefix(value, "{") {
+		return nil
+	}
+	i := strings.Index(value, ownerSeparator)
+	if i < 0 {
+		return nil
+	}
+	o := new(Owner)
+	if err := json.Unmarshal([]byte(value[:i]), o); err != nil {
+		return nil
+	}
+	return o
+}
+
+// Inspect describes the lock held at key, it returns an error satisfying
+// IsNotLocked if nobody holds it.
+func Inspect(ctx context.Context, redis inspector, key string) (*LockInfo, error) {
+	if key == "" {
+		return nil, errors.New("key length is zero")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return inspect(redis, key)
+}
+
+func inspect(r inspector, key string) (*LockInfo, error) {
+	value, err := r.Get(key).Result()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("key: %s, err: %w", key, errNotLocked)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := r.PTTL(key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if ttl == -2 {
+		// 在GET和PTTL之间过期.
+		return nil, fmt.Errorf("key: %s, err: %w", key, errNotLocked)
+	}
+	return &LockInfo{
+		Key:   key,
+		TTL:   ttl,
+		Owner: ParseOwner(value),
+	}, nil
+}
+
+// ListLocks describes every lock held under prefix, for a live view of lock
+// state. It walks the keyspace with SCAN cursors, never KEYS, so it does not
+// stall redis, and like any SCAN it may miss locks taken or see locks released
+// while it runs. prefix should only cover lock keys, other string keys under
+// it are listed as locks too. On redis cluster SCAN only covers one node,
+// call ListLocks for every master, e.g. in ForEachMaster.
+func ListLocks(ctx context.Context, redis scanner, prefix string) ([]LockInfo, error) {
+	match := globEscape(prefix) + "*"
+	var (
+		locks  []LockInfo
+		cursor uint64
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		keys, next, err := redis.Scan(cursor, match, 100).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			info, err := inspect(redis, key)
+			if IsNotLocked(err) || isWrongType(err) {
+				// 已过期或不是锁，如WithTag的集合.
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			locks = append(locks, *info)
+		}
+		if next == 0 {
+			return locks, nil
+		}
+		cursor = next
+	}
+}
+
+// globEscape escapes the glob characters of MATCH in s.
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isWrongType(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE")
+}
+
+// ContendedWait returns how long the lock at key will stay held at most
+// before it expires, negative if it never expires, in a single PTTL round
+// trip that does not try to acquire it. A scheduler may use it to decide
+// whether waiting for the lock is worth it or the work should be skipped.
+// If nobody holds the lock it returns 0 and an error satisfying IsNotLocked.
+func ContendedWait(ctx context.Context, redis inspector, key string) (time.Duration, error) {
+	if key == "" {
+		return 0, errors.New("key length is zero")
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	ttl, err := redis.PTTL(key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl == -2 {
+		return 0, fmt.Errorf("key: %s, err: %w", key, errNotLocked)
+	}
+	return ttl, nil
+}
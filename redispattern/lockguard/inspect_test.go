@@ -0,0 +1,132 @@
+package lockguard
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+)
+
+type traceIDKey struct{}
+
+func TestInspectTraceID(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+
+	if _, err := Inspect(context.Background(), mem, "lockguard:inspect"); !IsNotLocked(err) {
+		t.Fatalf("want not locked, got: %v", err)
+	}
+
+	guard, err := New(mem, "lockguard:inspect", WithTraceIDFunc(func(ctx context.Context) string {
+		id, _ := ctx.Value(traceIDKey{}).(string)
+		return id
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), traceIDKey{}, "4bf92f3577b34da6a3ce929d0e0e4736")
+	err = guard.Run(ctx, func(ctx context.Context) error {
+		info, err := Inspect(ctx, mem, "lockguard:inspect")
+		if err != nil {
+			return err
+		}
+		if info.Owner == nil || info.Owner.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("owner: %+v, want the trace id of Run", info.Owner)
+		}
+		if info.TTL <= 0 || info.TTL > 30*time.Second {
+			t.Errorf("ttl: %s, want within (0, 30s]", info.TTL)
+		}
+		if ok, err := guard.OwnsLock(ctx); err != nil || !ok {
+			t.Errorf("OwnsLock: %t, %v, want: true, nil", ok, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseOwner(t *testing.T) {
+	tests := [...]struct {
+		In   string
+		Want *Owner
+	}{
+		0: {
+			"\x01\x02random",
+			nil,
+		},
+		1: {
+			"{broken\nrandom",
+			nil,
+		},
+		2: {
+			`{"trace_id":"abc"}` + "\n{random",
+			&Owner{TraceID: "abc"},
+		},
+		3: {
+			`{"instance_id":"pod-7"}` + "\nrandom",
+			&Owner{InstanceID: "pod-7"},
+		},
+	}
+	for _, test := range tests {
+		got := ParseOwner(test.In)
+		if (got == nil) != (test.Want == nil) || (got != nil && *got != *test.Want) {
+			t.Errorf("value: %q, want: %+v, got: %+v", test.In, test.Want, got)
+		}
+	}
+}
+
+func TestContendedWait(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+
+	if _, err := ContendedWait(context.Background(), mem, "lockguard:contended"); !IsNotLocked(err) {
+		t.Fatalf("want not locked, got: %v", err)
+	}
+	mem.SetNX("lockguard:contended", "other", time.Minute)
+	d, err := ContendedWait(context.Background(), mem, "lockguard:contended")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d <= 0 || d > time.Minute {
+		t.Errorf("wait: %s, want within (0, 1m]", d)
+	}
+}
+
+func TestListLocks(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+
+	guard, err := New(mem, "jobs:[a]", WithTag("jobs"), WithTraceIDFunc(func(ctx context.Context) string { return "abc" }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem.SetNX("jobs:b", "other", time.Minute)
+	mem.SetNX("jobs:a", "other", time.Minute)
+	mem.SetNX("users:a", "other", time.Minute)
+	err = guard.Run(context.Background(), func(ctx context.Context) error {
+		mem.SAdd("jobs:set", "not a lock")
+		locks, err := ListLocks(ctx, mem, "jobs:[")
+		if err != nil {
+			return err
+		}
+		if len(locks) != 1 || locks[0].Key != "jobs:[a]" {
+			t.Fatalf("locks: %+v, want only jobs:[a]", locks)
+		}
+		if locks[0].Owner == nil || locks[0].Owner.TraceID != "abc" {
+			t.Errorf("owner: %+v, want the trace id of Run", locks[0].Owner)
+		}
+		locks, err = ListLocks(ctx, mem, "jobs:")
+		if err != nil {
+			return err
+		}
+		if len(locks) != 3 {
+			t.Errorf("locks: %+v, want 3 locks skipping the set", locks)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,65 @@
+package lockguard
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// RunKeep runs handler like Run but keeps the lock when handler returns
+// nil, renewing it until the returned release is called. release unlocks and
+// returns the error Run would have returned, it is safe to call more than
+// once. If handler fails, panics or the lock is not obtained, RunKeep
+// releases at once and returns the error of Run with a nil release.
+//
+// The hold is still bounded by ctx and WithHandlerTimeout: once either ends
+// the lock is released and release returns the context error. Forgetting to
+// call release leaks a goroutine and keeps the lock renewed until then, so
+// pass a ctx which ends when the process gives up on the follow-up step.
+// The guard must not be reused before release returns. A guard configured
+// WithAutoRenew(false) cannot keep its lock, RunKeep returns an error then.
+func (guard *LockGuard) RunKeep(ctx context.Context, handler Handler) (func() error, error) {
+	if guard.lock.noRenew {
+		return nil, errors.New("keeping the lock is not supported without auto renew")
+	}
+	kept := make(chan error, 1)
+	done := make(chan error, 1)
+	releasing := make(chan struct{})
+	go func() {
+		_, err := guard.run(ctx, guard.lock.retryTimes, func(ctx context.Context) error {
+			err := handler(ctx)
+			kept <- err
+			if err != nil {
+				return err
+			}
+			// 保持持有，续期直至release或ctx结束.
+			select {
+			case <-releasing:
+			case <-ctx.Done():
+			}
+			return nil
+		})
+		done <- err
+	}()
+
+	select {
+	case err := <-kept:
+		if err != nil {
+			return nil, <-done
+		}
+	case err := <-done:
+		return nil, err
+	}
+	var (
+		once sync.Once
+		err  error
+	)
+	release := func() error {
+		once.Do(func() {
+			close(releasing)
+			err = <-done
+		})
+		return err
+	}
+	return release, nil
+}
@@ -0,0 +1,71 @@
+package lockguard
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+)
+
+func TestRunKeep(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	guard, err := New(mem, "lockguard:keep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	guard.lock.expiration = 60 * time.Millisecond
+	guard.lock.renewInterval = 20 * time.Millisecond
+
+	release, err := guard.RunKeep(context.Background(), func(ctx context.Context) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if ok, _ := mem.SetNX("lockguard:keep", "other", 0).Result(); ok {
+		t.Fatal("the kept lock should be renewed past its expiration")
+	}
+	if err := release(); err != nil {
+		t.Fatal(err)
+	}
+	if err := release(); err != nil {
+		t.Errorf("a second release: %v", err)
+	}
+	if n, _ := mem.Exists("lockguard:keep").Result(); n != 0 {
+		t.Error("release should unlock")
+	}
+
+	boom := errors.New("boom")
+	release, err = guard.RunKeep(context.Background(), func(ctx context.Context) error { return boom })
+	if release != nil || !errors.Is(err, boom) {
+		t.Errorf("want a nil release and %v, got: %v", boom, err)
+	}
+	if n, _ := mem.Exists("lockguard:keep").Result(); n != 0 {
+		t.Error("a failed handler should not keep the lock")
+	}
+}
+
+func TestRunKeepWithoutAutoRenew(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	guard, err := New(mem, "lockguard:keep:norenew", WithAutoRenew(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran := false
+	release, err := guard.RunKeep(context.Background(), func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	if err == nil || release != nil {
+		t.Fatal("RunKeep should refuse a guard without auto renew")
+	}
+	if ran {
+		t.Error("handler should not run")
+	}
+	if n, _ := mem.Exists("lockguard:keep:norenew").Result(); n != 0 {
+		t.Error("the lock should not be obtained")
+	}
+}
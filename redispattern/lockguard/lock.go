@@ -1,7 +1,11 @@
 package lockguard
 
 import (
+	"context"
+	"io"
 	"time"
+
+	"github.com/xiaojiaoyu100/lizard/backoff"
 )
 
 // Lock redis lock
@@ -12,4 +16,32 @@ type Lock struct {
 	locked     bool
 	retryTimes int
 	expiration time.Duration
+	backOff    backoff.BackOff
+	randReader io.Reader
+
+	backoffBase      time.Duration
+	backoffCap       time.Duration
+	renewRetries     int
+	renewInterval    time.Duration
+	renewJitter      float64
+	operationTimeout time.Duration
+	handlerTimeout   time.Duration
+	noRenew          bool
+	providedValue    string
+	traceIDFunc      func(ctx context.Context) string
+	instanceID       string
+
+	logger               Logger
+	observer             Observer
+	slowAcquireThreshold time.Duration
+	tag                  string
+	manager              *Manager
+	renewer              *Renewer
+	maxWaiters           int
+	initialJitter        time.Duration
+	unlockPolicy         UnlockFailurePolicy
+	fencing              bool
+	epochCheck           bool
+	ttlCheckEvery        int
+	ttlCheckThreshold    time.Duration
 }
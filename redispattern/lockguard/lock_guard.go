@@ -6,25 +6,34 @@ import (
 	"crypto/rc4"
 	"errors"
 	"fmt"
+	"io"
+	mathrand "math/rand"
+	"sync"
 	"time"
 
 	"github.com/xiaojiaoyu100/lizard/backoff"
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/runner"
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/script"
 )
 
 const (
 	redisLockKey = "HHsYC5oVzLjFuWE4KMz923QT"
 
-	delLuaScript = `
-if redis.call("get", KEYS[1]) == ARGV[1] then
-	return redis.call("del", KEYS[1])
-else
-	return 0
-end`
+	delLuaScript = script.LockGuardDel
 )
 
 // LockGuard provides distributed lock.
 type LockGuard struct {
-	lock Lock
+	lock   Lock
+	src    []byte      // reused buffer for the random value
+	cipher *rc4.Cipher // created once per guard
+
+	renewedAt time.Time // last time the ttl was set, only touched by the renewal goroutine once locked
+	token     int64     // fencing token of the current Run
+	epoch     int64     // epoch of the current Run, see WithEpochCheck
+	renewals  int       // renewals of the current Run, only touched by the renewal goroutine
+
+	valueMu sync.Mutex // guards lock.Value against Transfer and ReleaseAll
 }
 
 // New 生成一个锁，同一个LockGuard实例不可用于并发环境中，并发环境中应该
@@ -36,120 +45,341 @@ func New(redis rediser, key string, setters ...Setter) (*LockGuard, error) {
 
 	guard := new(LockGuard)
 	l := Lock{
-		redis:      redis,
-		Key:        key,
-		Value:      "",
-		retryTimes: 1,
-		expiration: 30 * time.Second,
+		redis:        redis,
+		Key:          key,
+		Value:        "",
+		retryTimes:   1,
+		expiration:   30 * time.Second,
+		renewRetries: 2,
+		renewJitter:  0.1,
+		randReader:   rand.Reader,
+		backoffBase:  20 * time.Millisecond,
+		backoffCap:   100 * time.Millisecond,
 	}
 	for _, setter := range setters {
 		if err := setter(&l); err != nil {
 			return nil, err
 		}
 	}
+	if l.renewInterval == 0 {
+		l.renewInterval = l.expiration / 3
+	}
+	if l.renewInterval >= l.expiration {
+		return nil, errors.New("renew interval is not less than expiration")
+	}
+	if l.backoffBase > l.backoffCap {
+		return nil, errors.New("backoff base is greater than backoff cap")
+	}
+	if l.backOff == nil {
+		l.backOff = backoff.NewStrategyBackOff(backoff.ExponentialBackoffFullJitterStrategy{
+			ExponentialBackoff: backoff.ExponentialBackoff{
+				Base: l.backoffBase,
+				Cap:  l.backoffCap,
+			}})
+	}
+	if _, ok := redis.(tagRediser); l.tag != "" && !ok {
+		return nil, errors.New("redis does not support tags")
+	}
+	if l.renewer != nil && l.renewer.interval >= l.expiration {
+		return nil, errors.New("renewer interval is not less than expiration")
+	}
+	if l.epochCheck && !epochKeySupported(key) {
+		return nil, errors.New("epoch check is not supported with a } outside the hash tag of key")
+	}
+	if l.renewer != nil && l.epochCheck {
+		return nil, errors.New("epoch check is not supported with a renewer")
+	}
+	if l.operationTimeout > 0 && !supportsTimeout(redis) {
+		return nil, fmt.Errorf("operation timeout: %w", errUnsupported)
+	}
+	if _, ok := redis.(fencer); (l.fencing || l.epochCheck) && !ok {
+		return nil, fmt.Errorf("incr: %w", errUnsupported)
+	}
+	if l.ttlCheckEvery > 0 && l.ttlCheckThreshold == 0 {
+		l.ttlCheckThreshold = l.expiration / 2
+	}
+	if _, ok := redis.(inspector); l.ttlCheckEvery > 0 && !ok {
+		return nil, fmt.Errorf("pttl: %w", errUnsupported)
+	}
 	guard.lock = l
+	cipher, err := rc4.NewCipher([]byte(redisLockKey))
+	if err != nil {
+		return nil, err
+	}
+	guard.src = make([]byte, len(redisLockKey))
+	guard.cipher = cipher
 	return guard, nil
 }
 
 // Run 锁住
+//
+// The errors of Run are, by precedence: a *NotObtainedError if the lock was
+// not obtained within the attempts and handler did not run; the bare
+// ctx.Err() if ctx was done before the lock was obtained or handler returned;
+// an error satisfying IsHandlerTimeout if the handler timeout passed first; a
+// *HandlerError if handler failed or panicked; a *UnlockError if only
+// releasing the lock failed, see WithUnlockFailurePolicy.
+// A failed release behind a *HandlerError is reported in its Unlock, behind
+// ctx.Err() or a handler timeout it is logged; the lock then expires on its own.
+//
+// By default handler runs on its own goroutine next to a renewal goroutine,
+// two goroutines, a few channels and a timer per Run. With WithAutoRenew(false)
+// handler runs inline on the caller's goroutine instead, which leaves the
+// redis round trips to obtain and release as the cost of a Run.
 func (guard *LockGuard) Run(ctx context.Context, handler Handler) error {
-	for i := 0; i < guard.lock.retryTimes; i++ {
-		guard.reset()
-		guard.obtain()
+	_, err := guard.run(ctx, guard.lock.retryTimes, handler)
+	return err
+}
+
+// WithLock runs handler under the lock at key with a fresh LockGuard, it is
+// New followed by Run and returns the error of either. A guard per call makes
+// it safe for concurrent use as long as the setters do not share state:
+// WithBackOff and WithRandReader keep the BackOff or reader they are given,
+// so concurrent calls need a setter each, e.g. WithBackOff(newBackOff()),
+// or a reader safe for concurrent use like crypto/rand.Reader.
+// Keep New and Run for reusing a guard.
+func WithLock(ctx context.Context, redis rediser, key string, handler Handler, setters ...Setter) error {
+	guard, err := New(redis, key, setters...)
+	if err != nil {
+		return err
+	}
+	return guard.Run(ctx, handler)
+}
+
+// TryRunN tries to obtain the lock up to attempts times and runs handler with
+// renewal if it does. Unlike Run, failing to obtain the lock is not an error:
+// it returns (false, nil), or the context error if ctx ended the attempts.
+// Otherwise it returns true and the error of handler.
+func (guard *LockGuard) TryRunN(ctx context.Context, attempts int, handler Handler) (bool, error) {
+	if attempts < 1 {
+		return false, errors.New("attempts is less than 1")
+	}
+	obtained, err := guard.run(ctx, attempts, handler)
+	if !obtained && IsLockNotObtained(err) {
+		return false, ctx.Err()
+	}
+	return obtained, err
+}
+
+// run tries to obtain the lock up to retryTimes times and reports whether it did.
+func (guard *LockGuard) run(ctx context.Context, retryTimes int, handler Handler) (bool, error) {
+	guard.reset()
+	// 失败的尝试不会写入任何值，所以每次Run只生成一次value即可.
+	if err := guard.newValue(ctx); err != nil {
+		return false, err
+	}
+	// 每次Run重置回退状态，避免上一次Run的jitter状态泄漏.
+	guard.lock.backOff.Reset()
+	start := time.Now()
+	attempts := 0
+	waiting := false
+	defer func() {
+		if waiting {
+			guard.leaveWait()
+		}
+	}()
+	cancelled := false
+	// ctx结束于首次尝试之前，不再尝试.
+	if d := guard.lock.initialJitter; d > 0 && !sleep(ctx, time.Duration(mathrand.Int63n(int64(d)))) {
+		cancelled = true
+		retryTimes = 0
+	}
+	for i := 0; i < retryTimes; i++ {
+		attempts++
+		if err := guard.obtain(ctx); err != nil && guard.lock.providedValue == "" {
+			// SETNX可能已在断开前写入，如故障转移后重连到其他节点，
+			// 其结果未知，换新value，不与可能残留的旧value混淆.
+			if err := guard.newValue(ctx); err != nil {
+				return false, err
+			}
+		}
 		if !guard.lock.locked {
-			if guard.lock.retryTimes > 1 {
-				time.Sleep(backoff.ExponentialBackoffFullJitterStrategy{
-					ExponentialBackoff: backoff.ExponentialBackoff{
-						Base: 20 * time.Millisecond,
-						Cap:  100 * time.Millisecond,
-					}}.Backoff(i))
+			if i == 0 && retryTimes > 1 && guard.lock.maxWaiters > 0 {
+				if err := guard.joinWait(ctx); err != nil {
+					return false, err
+				}
+				waiting = true
+			}
+			if i+1 < retryTimes && !guard.wait(ctx) {
+				// 区分ctx结束与回退策略终止.
+				cancelled = ctx.Err() != nil
+				break
 			}
 			continue
 		}
+		if waiting {
+			guard.leaveWait()
+			waiting = false
+		}
+		handlerCtx, err := guard.fence(context.WithValue(ctx, lockKeyKey{}, guard.lock.Key))
+		if err != nil {
+			_ = guard.unLock()
+			return false, err
+		}
+		if err := guard.takeEpoch(handlerCtx); err != nil {
+			_ = guard.unLock()
+			return false, err
+		}
+		if guard.lock.handlerTimeout > 0 {
+			var cancel context.CancelFunc
+			handlerCtx, cancel = context.WithTimeout(handlerCtx, guard.lock.handlerTimeout)
+			defer cancel()
+		}
+		guard.onAcquire(time.Since(start), attempts)
+		stopWatch := guard.watchHold()
+		var unlockErr error
+		release := func() {
+			stopWatch()
+			unlockErr = guard.release()
+		}
+		if guard.lock.noRenew {
+			err = runner.Inline(handlerCtx, release, handler)
+			return true, guard.runError(ctx, handlerCtx, err, unlockErr)
+		}
 
-		t := time.NewTicker(guard.tickInterval())
-		stop := make(chan struct{})
-		errChan := make(chan error)
-
-		go func() {
-			defer func() {
-				if r := recover(); r != nil {
-					close(stop)
-					if _, ok := r.(error); ok {
-						errChan <- fmt.Errorf("%w", r.(error))
-					} else {
-						errChan <- fmt.Errorf("%+v", r)
-					}
-					return
-				}
-				close(stop)
-			}()
-			errChan <- handler(ctx)
-		}()
-
-		go func() {
-			for {
-				select {
-				case <-t.C:
-					guard.renewTTL()
-				case <-stop:
-					return
-				}
+		renewal := runner.Renewal{
+			Interval: guard.lock.renewInterval,
+			Jitter:   guard.lock.renewJitter,
+			Renew:    guard.renewTTL,
+			OnPanic:  guard.renewPanicked,
+		}
+		if renewer := guard.lock.renewer; renewer != nil {
+			renewal = runner.Renewal{}
+			renewer.add(guard)
+			release = func() {
+				renewer.remove(guard)
+				stopWatch()
+				unlockErr = guard.release()
 			}
-		}()
-
-		var err error
-		select {
-		case <-ctx.Done():
-			err = ctx.Err()
-		case err = <-errChan:
 		}
-		guard.unLock()
-		t.Stop()
-		return err
+		err = runner.Run(handlerCtx, renewal, release, handler)
+		return true, guard.runError(ctx, handlerCtx, err, unlockErr)
+	}
+	if cancelled {
+		guard.onAcquireCancelled(time.Since(start), attempts)
+		return false, ctx.Err()
+	}
+	return false, &NotObtainedError{
+		Key:      guard.lock.Key,
+		Attempts: attempts,
+		Elapsed:  time.Since(start),
 	}
-	return fmt.Errorf("key: %s, err: %w", guard.lock.Key, errLockNotObtained)
 }
 
-func (guard *LockGuard) renewTTL() {
-	guard.lock.redis.Expire(guard.lock.Key, guard.lock.expiration)
+// wait sleeps for the next backoff, it returns false if retrying should stop.
+func (guard *LockGuard) wait(ctx context.Context) bool {
+	d := guard.lock.backOff.NextBackOff()
+	if d == backoff.Stop {
+		return false
+	}
+	return sleep(ctx, d)
 }
 
-func (guard *LockGuard) tickInterval() time.Duration {
-	return time.Second * 6
+// sleep sleeps for d, it returns false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
-func (guard *LockGuard) obtain() {
-	src := make([]byte, len(redisLockKey))
-	_, err := rand.Read(src)
-	if err != nil {
-		return
+// newValue generates the value of the lock with its owner metadata.
+func (guard *LockGuard) newValue(ctx context.Context) error {
+	if err := guard.genValue(); err != nil {
+		return err
 	}
-	redisLockKeyByte := make([]byte, len(redisLockKey))
-	copy(redisLockKeyByte[:], redisLockKey)
-	cipher, err := rc4.NewCipher(redisLockKeyByte)
-	if err != nil {
-		return
+	return guard.attachOwner(ctx)
+}
+
+func (guard *LockGuard) genValue() error {
+	if guard.lock.providedValue != "" {
+		guard.setValue(guard.lock.providedValue)
+		return nil
+	}
+	if _, err := io.ReadFull(guard.lock.randReader, guard.src); err != nil {
+		return err
 	}
-	cipher.XORKeyStream(src, src)
-	guard.lock.Value = string(src)
-	cmd := guard.lock.redis.SetNX(guard.lock.Key, guard.lock.Value, guard.lock.expiration)
+	guard.cipher.XORKeyStream(guard.src, guard.src)
+	guard.setValue(string(guard.src))
+	return nil
+}
+
+// setValue sets lock.Value under valueMu, a guard left registered with a
+// Manager after a failed unlock may be released by ReleaseAll meanwhile.
+func (guard *LockGuard) setValue(v string) {
+	guard.valueMu.Lock()
+	guard.lock.Value = v
+	guard.valueMu.Unlock()
+}
+
+// obtain tries to obtain the lock once, an error means the outcome is unknown.
+func (guard *LockGuard) obtain(ctx context.Context) error {
+	r, cancel := guard.client(ctx)
+	cmd := r.SetNX(guard.lock.Key, guard.lock.Value, guard.lock.expiration)
+	cancel()
 	flag, err := cmd.Result()
 	if err != nil {
-		return
+		return err
 	}
 	guard.lock.locked = flag
+	if flag {
+		guard.renewedAt = time.Now()
+		guard.addTag(ctx)
+		guard.register()
+	}
+	return nil
 }
 
 func (guard *LockGuard) reset() {
 	guard.lock.locked = false
-	guard.lock.Value = ""
+	guard.setValue("")
+	guard.token = 0
+	guard.epoch = 0
+	guard.renewals = 0
 }
 
-func (guard *LockGuard) unLock() {
+func (guard *LockGuard) unLock() error {
 	if !guard.lock.locked {
-		return
+		return nil
 	}
 	keys := []string{guard.lock.Key}
-	guard.lock.redis.Eval(delLuaScript, keys, guard.lock.Value)
+	// 释放不受调用者ctx影响，仅受操作超时限制，ctx结束后仍需释放锁.
+	r, cancel := guard.client(context.Background())
+	defer cancel()
+	// 若ctx先结束，handler可能仍在运行并调用Transfer.
+	guard.valueMu.Lock()
+	n, err := r.Eval(delLuaScript, keys, guard.lock.Value).Int64()
+	guard.valueMu.Unlock()
+	if err != nil {
+		// 释放失败时仍由Manager跟踪，ReleaseAll可再次释放.
+		return &UnlockError{Key: guard.lock.Key, Err: err}
+	}
+	guard.deregister()
+	if n == 1 {
+		guard.removeTag()
+	}
+	return nil
+}
+
+// runError picks the error of a Run which obtained the lock, see Run.
+func (guard *LockGuard) runError(ctx, handlerCtx context.Context, err, unlockErr error) error {
+	if err != nil && unlockErr != nil && (err == ctx.Err() || err == handlerCtx.Err()) {
+		guard.logf("lockguard: unlock failed, key: %s, err: %v", guard.lock.Key, unlockErr)
+	}
+	if err != nil && err == ctx.Err() {
+		return err
+	}
+	if err != nil && err == handlerCtx.Err() && err == context.DeadlineExceeded && guard.lock.handlerTimeout > 0 {
+		return fmt.Errorf("key: %s, handler timeout: %s, err: %w",
+			guard.lock.Key, guard.lock.handlerTimeout, errHandlerTimeout)
+	}
+	if err != nil {
+		var p *runner.PanicError
+		return &HandlerError{Err: err, Panicked: errors.As(err, &p), Unlock: unlockErr}
+	}
+	return unlockErr
 }
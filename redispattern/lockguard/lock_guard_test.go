@@ -0,0 +1,646 @@
+package lockguard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/redigoadapter"
+)
+
+var (
+	_ rediser    = (*memrediser.Client)(nil)
+	_ tagRediser = (*memrediser.Client)(nil)
+	_ inspector  = (*memrediser.Client)(nil)
+	_ fencer     = (*memrediser.Client)(nil)
+	_ scanner    = (*memrediser.Client)(nil)
+	_ rediser    = (*redigoadapter.Adapter)(nil)
+)
+
+// stubRediser answers every command with a fixed, preallocated result so that
+// benchmarks measure the guard rather than the client.
+type stubRediser struct {
+	setNX  *redis.BoolCmd
+	eval   *redis.Cmd
+	expire *redis.BoolCmd
+	onEval func(script string, keys []string, args []interface{})
+}
+
+func newStubRediser(obtained bool) *stubRediser {
+	return &stubRediser{
+		setNX:  redis.NewBoolResult(obtained, nil),
+		eval:   redis.NewCmdResult(int64(1), nil),
+		expire: redis.NewBoolResult(true, nil),
+	}
+}
+
+func (s *stubRediser) SetNX(key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	return s.setNX
+}
+
+func (s *stubRediser) Eval(script string, keys []string, args ...interface{}) *redis.Cmd {
+	if s.onEval != nil {
+		s.onEval(script, keys, args)
+	}
+	return s.eval
+}
+
+func (s *stubRediser) Expire(key string, expiration time.Duration) *redis.BoolCmd {
+	return s.expire
+}
+
+func TestObtainDoesNotAllocate(t *testing.T) {
+	guard, err := New(newStubRediser(false), "lockguard:test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := guard.genValue(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	// Only boxing the value into the SetNX argument is left per attempt.
+	allocs := testing.AllocsPerRun(100, func() { guard.obtain(ctx) })
+	if allocs > 1 {
+		t.Errorf("obtain allocates %v times per attempt, want at most 1", allocs)
+	}
+}
+
+func BenchmarkObtain(b *testing.B) {
+	guard, err := New(newStubRediser(false), "lockguard:bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := guard.genValue(); err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		guard.obtain(ctx)
+	}
+}
+
+func BenchmarkGenValue(b *testing.B) {
+	guard, err := New(newStubRediser(true), "lockguard:bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := guard.genValue(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	guard, err := New(newStubRediser(true), "lockguard:bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+	handler := func(ctx context.Context) error { return nil }
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := guard.Run(ctx, handler); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRunNoRenew(b *testing.B) {
+	guard, err := New(newStubRediser(true), "lockguard:bench", WithAutoRenew(false))
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+	handler := func(ctx context.Context) error { return nil }
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := guard.Run(ctx, handler); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRunMemrediser(b *testing.B) {
+	mem := memrediser.New()
+	defer mem.Close()
+	tests := [...]struct {
+		Name  string
+		Renew bool
+	}{
+		0: {
+			"renew",
+			true,
+		},
+		1: {
+			"inline",
+			false,
+		},
+	}
+	ctx := context.Background()
+	handler := func(ctx context.Context) error { return nil }
+	for _, test := range tests {
+		b.Run(test.Name, func(b *testing.B) {
+			guard, err := New(mem, "lockguard:bench", WithAutoRenew(test.Renew))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := guard.Run(ctx, handler); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRunNoRenewInline(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	guard, err := New(mem, "lockguard:inline", WithAutoRenew(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	boom := errors.New("boom")
+	err = guard.Run(context.Background(), func(ctx context.Context) error {
+		panic(boom)
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("want: %v, got: %v", boom, err)
+	}
+	if ok, _ := mem.SetNX("lockguard:inline", "other", 0).Result(); !ok {
+		t.Error("lock should be released after an inline handler panics")
+	}
+}
+
+func TestRunMutualExclusion(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+
+	var (
+		wg      sync.WaitGroup
+		holders int32
+		runs    int32
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			guard, err := New(mem, "lockguard:mutex", WithRetryTimes(1000))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			err = guard.Run(context.Background(), func(ctx context.Context) error {
+				if n := atomic.AddInt32(&holders, 1); n != 1 {
+					t.Errorf("%d holders inside the critical section", n)
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&holders, -1)
+				atomic.AddInt32(&runs, 1)
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if runs != 8 {
+		t.Errorf("runs: %d, want: 8", runs)
+	}
+}
+
+// recordBackOff records how many retries happened since the last Reset.
+type recordBackOff struct {
+	retries []int
+	n       int
+}
+
+func (b *recordBackOff) NextBackOff() time.Duration {
+	b.n++
+	b.retries = append(b.retries, b.n)
+	return 0
+}
+
+func (b *recordBackOff) Reset() {
+	b.n = 0
+}
+
+func TestWithBackoffBaseCap(t *testing.T) {
+	tests := [...]struct {
+		Setters  []Setter
+		WantErr  bool
+		WantBase time.Duration
+		WantCap  time.Duration
+	}{
+		0: {
+			WantBase: 20 * time.Millisecond,
+			WantCap:  100 * time.Millisecond,
+		},
+		1: {
+			Setters:  []Setter{WithBackoffBase(time.Millisecond), WithBackoffCap(4 * time.Millisecond)},
+			WantBase: time.Millisecond,
+			WantCap:  4 * time.Millisecond,
+		},
+		2: {
+			Setters: []Setter{WithBackoffBase(10 * time.Millisecond), WithBackoffCap(5 * time.Millisecond)},
+			WantErr: true,
+		},
+		3: {
+			Setters: []Setter{WithBackoffBase(0)},
+			WantErr: true,
+		},
+		4: {
+			Setters: []Setter{WithBackoffCap(-time.Millisecond)},
+			WantErr: true,
+		},
+	}
+	for i, test := range tests {
+		guard, err := New(newStubRediser(true), "lockguard:backoff:basecap", test.Setters...)
+		if (err != nil) != test.WantErr {
+			t.Fatalf("%d: err: %v, want err: %t", i, err, test.WantErr)
+		}
+		if err != nil {
+			continue
+		}
+		b := guard.lock.backOff
+		for j := 0; j < 100; j++ {
+			b.Reset()
+			// 首次重试不超过base，之后不超过cap.
+			if d := b.NextBackOff(); d < 0 || d > test.WantBase {
+				t.Fatalf("%d: first delay: %s, want within [0, %s]", i, d, test.WantBase)
+			}
+			for k := 0; k < 10; k++ {
+				if d := b.NextBackOff(); d < 0 || d > test.WantCap {
+					t.Fatalf("%d: delay: %s, want within [0, %s]", i, d, test.WantCap)
+				}
+			}
+		}
+	}
+}
+
+func TestRunResetsBackOff(t *testing.T) {
+	b := &recordBackOff{}
+	guard, err := New(newStubRediser(false), "lockguard:backoff", WithRetryTimes(3), WithBackOff(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := guard.Run(context.Background(), nil); !IsLockNotObtained(err) {
+			t.Fatalf("want lock not obtained, got: %v", err)
+		}
+	}
+	want := []int{1, 2, 1, 2}
+	if fmt.Sprint(b.retries) != fmt.Sprint(want) {
+		t.Errorf("retries: %v, want: %v", b.retries, want)
+	}
+}
+
+func TestRunNotObtainedError(t *testing.T) {
+	guard, err := New(newStubRediser(false), "lockguard:busy", WithRetryTimes(3), WithBackOff(&recordBackOff{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = guard.Run(context.Background(), nil)
+	if !IsLockNotObtained(err) {
+		t.Fatalf("want lock not obtained, got: %v", err)
+	}
+	var e *NotObtainedError
+	if !errors.As(err, &e) {
+		t.Fatalf("want *NotObtainedError, got: %T", err)
+	}
+	if e.Key != "lockguard:busy" || e.Attempts != 3 {
+		t.Errorf("key: %s, attempts: %d, want: lockguard:busy, 3", e.Key, e.Attempts)
+	}
+}
+
+func TestWithRandReader(t *testing.T) {
+	var values [2]string
+	for i := range values {
+		stub := newStubRediser(true)
+		stub.onEval = func(script string, keys []string, args []interface{}) {
+			if script == delLuaScript {
+				values[i] = args[0].(string)
+			}
+		}
+		reader := bytes.NewReader(bytes.Repeat([]byte{7}, len(redisLockKey)))
+		guard, err := New(stub, "lockguard:rand", WithRandReader(reader))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := guard.Run(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if values[0] == "" || values[0] != values[1] {
+		t.Errorf("unlock values: %q, want two equal non-empty values", values)
+	}
+}
+
+func TestTryRunN(t *testing.T) {
+	tests := [...]struct {
+		Obtained bool
+		WantRun  bool
+	}{
+		0: {
+			false,
+			false,
+		},
+		1: {
+			true,
+			true,
+		},
+	}
+	for _, test := range tests {
+		guard, err := New(newStubRediser(test.Obtained), "lockguard:tryrun", WithBackOff(&recordBackOff{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ran := false
+		obtained, err := guard.TryRunN(context.Background(), 2, func(ctx context.Context) error {
+			ran = true
+			return nil
+		})
+		if err != nil {
+			t.Errorf("obtained: %t, err: %v, want nil", test.Obtained, err)
+		}
+		if obtained != test.WantRun || ran != test.WantRun {
+			t.Errorf("obtained: %t, ran: %t, want: %t", obtained, ran, test.WantRun)
+		}
+	}
+}
+
+// busyRediser refuses the first busy calls to SetNX.
+type busyRediser struct {
+	*stubRediser
+	busy int
+}
+
+func (b *busyRediser) SetNX(key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	if b.busy > 0 {
+		b.busy--
+		return redis.NewBoolResult(false, nil)
+	}
+	return b.stubRediser.SetNX(key, value, expiration)
+}
+
+func TestOnAcquireAttempts(t *testing.T) {
+	o := &lostObserver{}
+	r := &busyRediser{stubRediser: newStubRediser(true), busy: 2}
+	guard, err := New(r, "lockguard:attempts", WithRetryTimes(5), WithBackOff(&recordBackOff{}), WithObserver(o))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := guard.Run(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(o.attempts) != 1 || o.attempts[0] != 3 {
+		t.Errorf("attempts: %v, want: [3]", o.attempts)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	boom := errors.New("boom")
+	tests := [...]struct {
+		Handler      Handler
+		UnlockFails  bool
+		Cancel       bool
+		WantPanicked bool
+		WantHandler  bool
+		WantUnlock   bool
+	}{
+		0: {
+			Handler:     func(ctx context.Context) error { return boom },
+			WantHandler: true,
+		},
+		1: {
+			Handler:      func(ctx context.Context) error { panic(boom) },
+			WantHandler:  true,
+			WantPanicked: true,
+		},
+		2: {
+			Handler:     func(ctx context.Context) error { return nil },
+			UnlockFails: true,
+			WantUnlock:  true,
+		},
+		3: {
+			Handler:     func(ctx context.Context) error { return boom },
+			UnlockFails: true,
+			WantHandler: true,
+		},
+		4: {
+			Handler: func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() },
+			Cancel:  true,
+		},
+	}
+	for i, test := range tests {
+		stub := newStubRediser(true)
+		if test.UnlockFails {
+			stub.eval = redis.NewCmdResult(nil, errors.New("i/o timeout"))
+		}
+		guard, err := New(stub, "lockguard:errors")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		if test.Cancel {
+			cancel()
+		}
+		err = guard.Run(ctx, test.Handler)
+		cancel()
+
+		var h *HandlerError
+		var u *UnlockError
+		if gotHandler := errors.As(err, &h); gotHandler != test.WantHandler {
+			t.Errorf("case: %d, handler error: %t, want: %t, err: %v", i, gotHandler, test.WantHandler, err)
+		}
+		if h != nil && (h.Panicked != test.WantPanicked || !errors.Is(err, boom)) {
+			t.Errorf("case: %d, panicked: %t, want: %t, err: %v", i, h.Panicked, test.WantPanicked, err)
+		}
+		if gotUnlock := errors.As(err, &u); gotUnlock != test.WantUnlock {
+			t.Errorf("case: %d, unlock error: %t, want: %t, err: %v", i, gotUnlock, test.WantUnlock, err)
+		}
+		if test.Cancel && err != context.Canceled {
+			t.Errorf("case: %d, want bare %v, got: %v", i, context.Canceled, err)
+		}
+	}
+}
+
+func TestWithHandlerTimeout(t *testing.T) {
+	guard, err := New(newStubRediser(true), "lockguard:handlertimeout", WithHandlerTimeout(5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if err := guard.Run(context.Background(), block); !IsHandlerTimeout(err) {
+		t.Errorf("want handler timeout, got: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := guard.Run(ctx, block); err != context.DeadlineExceeded {
+		t.Errorf("caller deadline, want: %v, got: %v", context.DeadlineExceeded, err)
+	}
+}
+
+// lossyRediser fails the first SetNX as a dropped connection would and
+// records the value of every attempt.
+type lossyRediser struct {
+	*stubRediser
+	values []string
+}
+
+func (l *lossyRediser) SetNX(key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	l.values = append(l.values, value.(string))
+	if len(l.values) == 1 {
+		return redis.NewBoolResult(false, errors.New("read: connection reset by peer"))
+	}
+	return l.stubRediser.SetNX(key, value, expiration)
+}
+
+func TestRunRegeneratesValueAfterError(t *testing.T) {
+	tests := [...]struct {
+		Setters  []Setter
+		WantSame bool
+	}{
+		0: {
+			nil,
+			false,
+		},
+		1: {
+			[]Setter{WithValue("job-42")},
+			true,
+		},
+	}
+	for i, test := range tests {
+		r := &lossyRediser{stubRediser: newStubRediser(true)}
+		setters := append([]Setter{WithRetryTimes(2), WithBackOff(&recordBackOff{})}, test.Setters...)
+		guard, err := New(r, "lockguard:lossy", setters...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := guard.Run(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		if len(r.values) != 2 {
+			t.Fatalf("case: %d, attempts: %d, want: 2", i, len(r.values))
+		}
+		if same := r.values[0] == r.values[1]; same != test.WantSame {
+			t.Errorf("case: %d, same value: %t, want: %t", i, same, test.WantSame)
+		}
+	}
+}
+
+func TestWithLock(t *testing.T) {
+	if err := WithLock(context.Background(), newStubRediser(true), "", nil); err == nil {
+		t.Error("an empty key should fail New")
+	}
+	mem := memrediser.New()
+	defer mem.Close()
+	var (
+		wg   sync.WaitGroup
+		runs int32
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := WithLock(context.Background(), mem, "lockguard:withlock", func(ctx context.Context) error {
+				atomic.AddInt32(&runs, 1)
+				return nil
+			}, WithRetryTimes(1000))
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if runs != 4 {
+		t.Errorf("runs: %d, want: 4", runs)
+	}
+}
+
+func TestWithInitialJitter(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	guard, err := New(mem, "lockguard:jitter", WithInitialJitter(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := guard.Run(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	guard, err = New(mem, "lockguard:jitter", WithInitialJitter(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = guard.Run(ctx, func(ctx context.Context) error {
+		t.Error("handler should not run")
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("want: %v, got: %v", context.Canceled, err)
+	}
+	if n, _ := mem.Exists("lockguard:jitter").Result(); n != 0 {
+		t.Error("no attempt should be made after ctx is done")
+	}
+}
+
+// cancelObserver records cancelled acquisitions.
+type cancelObserver struct {
+	lostObserver
+	cancelled []int
+}
+
+func (o *cancelObserver) OnAcquireCancelled(key string, elapsed time.Duration, attempts int) {
+	o.cancelled = append(o.cancelled, attempts)
+}
+
+func TestOnAcquireCancelled(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	mem.SetNX("lockguard:cancelled", "other", 0)
+	o := &cancelObserver{}
+	guard, err := New(mem, "lockguard:cancelled", WithRetryTimes(2), WithObserver(o))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := func(ctx context.Context) error { return nil }
+	if err := guard.Run(context.Background(), handler); !IsLockNotObtained(err) {
+		t.Errorf("exhausted retries want a not obtained error, got: %v", err)
+	}
+
+	guard, err = New(mem, "lockguard:cancelled", WithRetryTimes(1000), WithObserver(o))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := guard.Run(ctx, handler); err != context.DeadlineExceeded {
+		t.Errorf("want: %v, got: %v", context.DeadlineExceeded, err)
+	}
+	if len(o.cancelled) != 1 || o.cancelled[0] < 1 {
+		t.Errorf("cancelled: %v, want one event after some attempts", o.cancelled)
+	}
+}
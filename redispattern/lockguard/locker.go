@@ -0,0 +1,92 @@
+package lockguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+var _ sync.Locker = (*Locker)(nil)
+
+// Locker adapts a LockGuard to sync.Locker, for code written against
+// in-process mutexes. It is safe for concurrent use, goroutines of one
+// process sharing a Locker queue on a mutex before contending in redis.
+//
+// It is a best-effort adapter for simple cases only: Lock blocks until the
+// lock is obtained, retrying forever with no way to give up, also while
+// WithMaxWaiters turns it away, and both Lock and Unlock hide errors by
+// panicking on anything unrecoverable, e.g. a failing random source. A lock
+// lost while held is not reported either. Prefer Run wherever a context and
+// an error can be passed around.
+//
+// The lock is renewed while held and released by Unlock, so NewLocker
+// refuses a guard configured WithAutoRenew(false) or WithHandlerTimeout,
+// which would let the lock go before Unlock. The underlying LockGuard must
+// not be used elsewhere meanwhile.
+type Locker struct {
+	mu     sync.Mutex // held from Lock to Unlock, a guard runs once at a time
+	guard  *LockGuard
+	unlock chan struct{}
+	done   chan error
+}
+
+// NewLocker 生成Locker.
+func NewLocker(guard *LockGuard) (*Locker, error) {
+	if guard.lock.noRenew {
+		return nil, errors.New("locker is not supported without auto renew")
+	}
+	if guard.lock.handlerTimeout > 0 {
+		return nil, errors.New("locker is not supported with a handler timeout")
+	}
+	return &Locker{guard: guard}, nil
+}
+
+// Lock blocks until the lock is obtained, waiting for the backoff between
+// attempts.
+func (l *Locker) Lock() {
+	l.mu.Lock()
+	acquired := make(chan struct{})
+	unlock := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		for {
+			obtained, err := l.guard.run(context.Background(), math.MaxInt32, func(ctx context.Context) error {
+				close(acquired)
+				<-unlock
+				return nil
+			})
+			if obtained || !IsLockNotObtained(err) && !IsTooManyWaiters(err) {
+				done <- err
+				return
+			}
+			// 回退策略已终止或等待者已满，等待后重新开始.
+			time.Sleep(l.guard.lock.backoffCap)
+		}
+	}()
+	select {
+	case <-acquired:
+		l.unlock = unlock
+		l.done = done
+	case err := <-done:
+		l.mu.Unlock()
+		panic(fmt.Sprintf("lockguard: lock %s: %v", l.guard.lock.Key, err))
+	}
+}
+
+// Unlock releases the lock, it panics if the Locker is not locked.
+func (l *Locker) Unlock() {
+	if l.unlock == nil {
+		panic("lockguard: unlock of unlocked Locker")
+	}
+	unlock, done := l.unlock, l.done
+	l.unlock, l.done = nil, nil
+	close(unlock)
+	err := <-done
+	l.mu.Unlock()
+	if err != nil {
+		panic(fmt.Sprintf("lockguard: unlock %s: %v", l.guard.lock.Key, err))
+	}
+}
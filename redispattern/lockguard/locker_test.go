@@ -0,0 +1,155 @@
+package lockguard
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+)
+
+func TestLocker(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+
+	var (
+		wg      sync.WaitGroup
+		counter int
+	)
+	for i := 0; i < 4; i++ {
+		guard, err := New(mem, "lockguard:locker")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var l sync.Locker
+		if l, err = NewLocker(guard); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				l.Lock()
+				c := counter
+				time.Sleep(time.Millisecond)
+				counter = c + 1
+				l.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if counter != 20 {
+		t.Errorf("counter: %d, want: 20", counter)
+	}
+	if ok, _ := mem.SetNX("lockguard:locker", "other", 0).Result(); !ok {
+		t.Error("lock should be free after the last Unlock")
+	}
+}
+
+func TestLockerShared(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	guard, err := New(mem, "lockguard:locker:shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewLocker(guard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		counter int
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				l.Lock()
+				c := counter
+				time.Sleep(time.Millisecond)
+				counter = c + 1
+				l.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if counter != 40 {
+		t.Errorf("counter: %d, want: 40", counter)
+	}
+}
+
+// countingRediser counts the attempts to obtain the lock.
+type countingRediser struct {
+	*memrediser.Client
+	setNX int32
+}
+
+func (c *countingRediser) SetNX(key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	atomic.AddInt32(&c.setNX, 1)
+	return c.Client.SetNX(key, value, expiration)
+}
+
+func TestLockerWaitsBetweenAttempts(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	mem.SetNX("lockguard:locker:held", "other", 0)
+	r := &countingRediser{Client: mem}
+	guard, err := New(r, "lockguard:locker:held")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewLocker(guard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		mem.Del("lockguard:locker:held")
+	}()
+	l.Lock()
+	l.Unlock()
+	// 100ms内以20ms至100ms间的回退重试，远少于忙等.
+	if n := atomic.LoadInt32(&r.setNX); n > 50 {
+		t.Errorf("attempts: %d, want at most 50 while waiting 100ms", n)
+	}
+}
+
+func TestNewLockerValidation(t *testing.T) {
+	for i, setter := range []Setter{WithAutoRenew(false), WithHandlerTimeout(time.Second)} {
+		guard, err := New(newStubRediser(true), "lockguard:locker:validation", setter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewLocker(guard); err == nil {
+			t.Errorf("%d: want the guard refused", i)
+		}
+	}
+}
+
+func TestLockerTooManyWaiters(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	mem.SetNX("lockguard:locker:waiters", "other", 0)
+	// 另一个等待者已占满名额.
+	mem.SetNX(waitersKey("lockguard:locker:waiters"), 1, time.Minute)
+	guard, err := New(mem, "lockguard:locker:waiters", WithMaxWaiters(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewLocker(guard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		mem.Del(waitersKey("lockguard:locker:waiters"), "lockguard:locker:waiters")
+	}()
+	// Lock不应因等待者已满而panic.
+	l.Lock()
+	l.Unlock()
+}
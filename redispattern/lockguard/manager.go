@@ -0,0 +1,90 @@
+package lockguard
+
+import (
+	"context"
+	"sync"
+)
+
+// Manager tracks the locks held by the guards configured WithManager, so that
+// a service can release all of them at once, e.g. from its SIGTERM handler,
+// instead of leaving them to stall the next instance until they expire.
+// It is safe for concurrent use.
+type Manager struct {
+	mu    sync.Mutex
+	locks map[*LockGuard]struct{}
+}
+
+// NewManager 生成Manager.
+func NewManager() *Manager {
+	return &Manager{
+		locks: make(map[*LockGuard]struct{}),
+	}
+}
+
+func (m *Manager) register(guard *LockGuard) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.locks[guard] = struct{}{}
+}
+
+func (m *Manager) deregister(guard *LockGuard) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.locks, guard)
+}
+
+// Len returns how many locks are currently held.
+func (m *Manager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.locks)
+}
+
+// ReleaseAll releases every held lock still holding its value and returns the
+// first error met. Handlers keep running, their renewal notices the loss and
+// stops.
+func (m *Manager) ReleaseAll(ctx context.Context) error {
+	m.mu.Lock()
+	guards := make([]*LockGuard, 0, len(m.locks))
+	for guard := range m.locks {
+		guards = append(guards, guard)
+	}
+	m.mu.Unlock()
+
+	var first error
+	for _, guard := range guards {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := guard.forceRelease(ctx); err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		m.deregister(guard)
+	}
+	return first
+}
+
+// forceRelease releases the lock under its current value, which Transfer may
+// have replaced, on behalf of ReleaseAll.
+func (guard *LockGuard) forceRelease(ctx context.Context) error {
+	r, cancel := guard.client(ctx)
+	defer cancel()
+	guard.valueMu.Lock()
+	defer guard.valueMu.Unlock()
+	return r.Eval(delLuaScript, []string{guard.lock.Key}, guard.lock.Value).Err()
+}
+
+func (guard *LockGuard) register() {
+	if guard.lock.manager != nil {
+		guard.lock.manager.register(guard)
+	}
+}
+
+func (guard *LockGuard) deregister() {
+	if guard.lock.manager != nil {
+		guard.lock.manager.deregister(guard)
+	}
+}
@@ -0,0 +1,109 @@
+package lockguard
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+)
+
+// releaseOnceFailingRediser fails the first release.
+type releaseOnceFailingRediser struct {
+	*memrediser.Client
+	failed int32
+}
+
+func (r *releaseOnceFailingRediser) Eval(script string, keys []string, args ...interface{}) *redis.Cmd {
+	if script == delLuaScript && atomic.CompareAndSwapInt32(&r.failed, 0, 1) {
+		return redis.NewCmdResult(nil, errors.New("i/o timeout"))
+	}
+	return r.Client.Eval(script, keys, args...)
+}
+
+func TestManagerReleaseAll(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	m := NewManager()
+
+	keys := []string{"lockguard:manager:a", "lockguard:manager:b"}
+	var (
+		held    sync.WaitGroup
+		wg      sync.WaitGroup
+		release = make(chan struct{})
+	)
+	for _, key := range keys {
+		guard, err := New(mem, key, WithManager(m))
+		if err != nil {
+			t.Fatal(err)
+		}
+		held.Add(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := guard.Run(context.Background(), func(ctx context.Context) error {
+				held.Done()
+				<-release
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	held.Wait()
+	if n := m.Len(); n != 2 {
+		t.Fatalf("held: %d, want: 2", n)
+	}
+	if err := m.ReleaseAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if ok, _ := mem.SetNX(key, "other", 0).Result(); !ok {
+			t.Errorf("key: %s should be free after ReleaseAll", key)
+		}
+	}
+	close(release)
+	wg.Wait()
+	if n := m.Len(); n != 0 {
+		t.Errorf("held: %d, want: 0", n)
+	}
+}
+
+// TestManagerReleaseAllDuringRun 释放失败后guard仍被跟踪，再次Run时与ReleaseAll并发，
+// 以-race运行.
+func TestManagerReleaseAllDuringRun(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	r := &releaseOnceFailingRediser{Client: mem}
+	m := NewManager()
+	guard, err := New(r, "lockguard:manager:rerun", WithManager(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := func(ctx context.Context) error {
+		return nil
+	}
+	var unlockErr *UnlockError
+	if err := guard.Run(context.Background(), handler); !errors.As(err, &unlockErr) {
+		t.Fatalf("want: *UnlockError, got: %v", err)
+	}
+	if n := m.Len(); n != 1 {
+		t.Fatalf("held: %d, want: 1", n)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = m.ReleaseAll(context.Background())
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_ = guard.Run(context.Background(), handler)
+	}
+	<-done
+}
@@ -0,0 +1,609 @@
+// Package memrediser provides an in-process rediser for lockguard and rwlock.
+//
+// It keeps keys in a map guarded by a mutex, so a LockGuard backed by it
+// gives mutual exclusion between goroutines of one process only. It is meant
+// for local development, tests and single-instance deployments. Strings, sets
+// and sorted sets expire like in redis and every script of lockguard and
+// rwlock is supported; there is no Pipeline, so a Renewer cannot use it.
+package memrediser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/script"
+)
+
+var (
+	errUnsupportedScript = errors.New("memrediser: unsupported script")
+	errWrongType         = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+)
+
+type entry struct {
+	value    string
+	set      map[string]struct{} // non-nil if the key holds a set
+	zset     map[string]float64  // non-nil if the key holds a sorted set
+	expireAt time.Time           // zero means the key never expires
+}
+
+// str reports whether the key holds a string.
+func (e entry) str() bool {
+	return e.set == nil && e.zset == nil
+}
+
+func (e entry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+type option struct {
+	sweepInterval time.Duration
+}
+
+// Setter configures option.
+type Setter func(o *option)
+
+// WithSweepInterval configures how often expired keys are swept.
+func WithSweepInterval(d time.Duration) Setter {
+	return func(o *option) {
+		o.sweepInterval = d
+	}
+}
+
+// Client is an in-memory rediser, safe for concurrent use.
+type Client struct {
+	mu      sync.Mutex
+	entries map[string]entry
+	done    chan struct{}
+	once    sync.Once
+}
+
+// New returns a Client and starts its background sweeper, call Close to stop it.
+func New(setters ...Setter) *Client {
+	o := option{
+		sweepInterval: time.Second,
+	}
+	for _, setter := range setters {
+		setter(&o)
+	}
+	c := &Client{
+		entries: make(map[string]entry),
+		done:    make(chan struct{}),
+	}
+	go c.sweep(o.sweepInterval)
+	return c
+}
+
+// Close stops the background sweeper.
+func (c *Client) Close() {
+	c.once.Do(func() {
+		close(c.done)
+	})
+}
+
+func (c *Client) sweep(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C:
+			c.mu.Lock()
+			for key, e := range c.entries {
+				if e.expired(now) {
+					delete(c.entries, key)
+				}
+			}
+			c.mu.Unlock()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// get must be called with c.mu held, it drops the key if it has expired.
+func (c *Client) get(key string, now time.Time) (entry, bool) {
+	e, ok := c.entries[key]
+	if !ok {
+		return entry{}, false
+	}
+	if e.expired(now) {
+		delete(c.entries, key)
+		return entry{}, false
+	}
+	return e, true
+}
+
+// SetNX sets key to value if key does not exist, zero expiration means no expiry.
+func (c *Client) SetNX(key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if _, ok := c.get(key, now); ok {
+		return redis.NewBoolResult(false, nil)
+	}
+	e := entry{value: toString(value)}
+	if expiration > 0 {
+		e.expireAt = now.Add(expiration)
+	}
+	c.entries[key] = e
+	return redis.NewBoolResult(true, nil)
+}
+
+// Set sets key to value, zero expiration means no expiry.
+func (c *Client) Set(key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := entry{value: toString(value)}
+	if expiration > 0 {
+		e.expireAt = time.Now().Add(expiration)
+	}
+	c.entries[key] = e
+	return redis.NewStatusResult("OK", nil)
+}
+
+// Expire sets a timeout on key, a non-positive expiration deletes the key.
+func (c *Client) Expire(key string, expiration time.Duration) *redis.BoolCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	e, ok := c.get(key, now)
+	if !ok {
+		return redis.NewBoolResult(false, nil)
+	}
+	if expiration <= 0 {
+		delete(c.entries, key)
+		return redis.NewBoolResult(true, nil)
+	}
+	e.expireAt = now.Add(expiration)
+	c.entries[key] = e
+	return redis.NewBoolResult(true, nil)
+}
+
+// Eval runs one of the scripts of lockguard and rwlock, any other script fails.
+func (c *Client) Eval(s string, keys []string, args ...interface{}) *redis.Cmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	switch s {
+	case script.LockGuardDel:
+		if len(keys) != 1 || len(args) != 1 {
+			return redis.NewCmdResult(nil, errors.New("memrediser: wrong number of arguments"))
+		}
+		e, ok := c.get(keys[0], now)
+		if !ok || !e.str() || e.value != toString(args[0]) {
+			return redis.NewCmdResult(int64(0), nil)
+		}
+		delete(c.entries, keys[0])
+		return redis.NewCmdResult(int64(1), nil)
+	case script.LockGuardExtend:
+		if len(keys) != 1 || len(args) != 2 {
+			return redis.NewCmdResult(nil, errors.New("memrediser: wrong number of arguments"))
+		}
+		return c.extend(keys[0], args[0], args[1], now)
+	case script.LockGuardTransfer:
+		if len(keys) != 1 || len(args) != 3 {
+			return redis.NewCmdResult(nil, errors.New("memrediser: wrong number of arguments"))
+		}
+		e, ok := c.get(keys[0], now)
+		if !ok || !e.str() || e.value != toString(args[0]) {
+			return redis.NewCmdResult(int64(0), nil)
+		}
+		ms, err := strconv.ParseInt(toString(args[2]), 10, 64)
+		if err != nil || ms <= 0 {
+			return redis.NewCmdResult(nil, errors.New("ERR invalid expire time in set"))
+		}
+		c.entries[keys[0]] = entry{
+			value:    toString(args[1]),
+			expireAt: now.Add(time.Duration(ms) * time.Millisecond),
+		}
+		return redis.NewCmdResult(int64(1), nil)
+	case script.LockGuardJoinWait:
+		if len(keys) != 1 || len(args) != 2 {
+			return redis.NewCmdResult(nil, errors.New("memrediser: wrong number of arguments"))
+		}
+		max, err := strconv.ParseInt(toString(args[0]), 10, 64)
+		if err != nil {
+			return redis.NewCmdResult(nil, errors.New("ERR value is not an integer or out of range"))
+		}
+		ms, err := strconv.ParseInt(toString(args[1]), 10, 64)
+		if err != nil {
+			return redis.NewCmdResult(nil, errors.New("ERR value is not an integer or out of range"))
+		}
+		e, _ := c.get(keys[0], now)
+		n, _ := strconv.ParseInt(e.value, 10, 64)
+		if n >= max {
+			return redis.NewCmdResult(int64(0), nil)
+		}
+		c.entries[keys[0]] = entry{
+			value:    strconv.FormatInt(n+1, 10),
+			expireAt: now.Add(time.Duration(ms) * time.Millisecond),
+		}
+		return redis.NewCmdResult(int64(1), nil)
+	case script.LockGuardLeaveWait:
+		if len(keys) != 1 {
+			return redis.NewCmdResult(nil, errors.New("memrediser: wrong number of arguments"))
+		}
+		e, ok := c.get(keys[0], now)
+		n, _ := strconv.ParseInt(e.value, 10, 64)
+		if !ok || n <= 1 {
+			delete(c.entries, keys[0])
+		} else {
+			e.value = strconv.FormatInt(n-1, 10)
+			c.entries[keys[0]] = e
+		}
+		return redis.NewCmdResult(int64(1), nil)
+	case script.LockGuardAcquireOrGet:
+		if len(keys) != 1 || len(args) != 2 {
+			return redis.NewCmdResult(nil, errors.New("memrediser: wrong number of arguments"))
+		}
+		ms, err := strconv.ParseInt(toString(args[1]), 10, 64)
+		if err != nil || ms <= 0 {
+			return redis.NewCmdResult(nil, errors.New("ERR invalid expire time in set"))
+		}
+		if e, ok := c.get(keys[0], now); ok {
+			if !e.str() {
+				return redis.NewCmdResult(nil, errWrongType)
+			}
+			return redis.NewCmdResult(e.value, nil)
+		}
+		c.entries[keys[0]] = entry{
+			value:    toString(args[0]),
+			expireAt: now.Add(time.Duration(ms) * time.Millisecond),
+		}
+		return redis.NewCmdResult(int64(1), nil)
+	case script.LockGuardExtendEpoch:
+		if len(keys) != 2 || len(args) != 3 {
+			return redis.NewCmdResult(nil, errors.New("memrediser: wrong number of arguments"))
+		}
+		var current int64
+		if e, ok := c.get(keys[1], now); ok {
+			current, _ = strconv.ParseInt(e.value, 10, 64)
+		}
+		epoch, err := strconv.ParseInt(toString(args[2]), 10, 64)
+		if err != nil {
+			return redis.NewCmdResult(nil, errors.New("ERR value is not an integer or out of range"))
+		}
+		if current < epoch {
+			return redis.NewCmdResult(int64(-1), nil)
+		}
+		return c.extend(keys[0], args[0], args[1], now)
+	case script.RWLockRead, script.RWLockWrite, script.RWLockUpgrade, script.RWLockRenew:
+		if len(keys) != 1 || len(args) != 3 {
+			return redis.NewCmdResult(nil, errors.New("memrediser: wrong number of arguments"))
+		}
+		ms, err := strconv.ParseInt(toString(args[1]), 10, 64)
+		if err != nil {
+			return redis.NewCmdResult(nil, errors.New("ERR value is not an integer or out of range"))
+		}
+		ttl, err := strconv.ParseInt(toString(args[2]), 10, 64)
+		if err != nil {
+			return redis.NewCmdResult(nil, errors.New("ERR value is not an integer or out of range"))
+		}
+		return c.rwlock(s, keys[0], toString(args[0]), ms, ttl, now)
+	case script.RWLockRelease:
+		if len(keys) != 1 || len(args) != 1 {
+			return redis.NewCmdResult(nil, errors.New("memrediser: wrong number of arguments"))
+		}
+		e, ok := c.get(keys[0], now)
+		if !ok {
+			return redis.NewCmdResult(int64(0), nil)
+		}
+		if e.zset == nil {
+			return redis.NewCmdResult(nil, errWrongType)
+		}
+		m := toString(args[0])
+		if _, ok := e.zset[m]; !ok {
+			return redis.NewCmdResult(int64(0), nil)
+		}
+		delete(e.zset, m)
+		if len(e.zset) == 0 {
+			delete(c.entries, keys[0])
+		}
+		return redis.NewCmdResult(int64(1), nil)
+	}
+	return redis.NewCmdResult(nil, errUnsupportedScript)
+}
+
+// extend sets the ttl of key to ms milliseconds if it holds value, it must be
+// called with c.mu held.
+func (c *Client) extend(key string, value, ms interface{}, now time.Time) *redis.Cmd {
+	e, ok := c.get(key, now)
+	if !ok || !e.str() || e.value != toString(value) {
+		return redis.NewCmdResult(int64(0), nil)
+	}
+	n, err := strconv.ParseInt(toString(ms), 10, 64)
+	if err != nil {
+		return redis.NewCmdResult(nil, errors.New("ERR value is not an integer or out of range"))
+	}
+	if n <= 0 {
+		delete(c.entries, key)
+		return redis.NewCmdResult(int64(1), nil)
+	}
+	e.expireAt = now.Add(time.Duration(n) * time.Millisecond)
+	c.entries[key] = e
+	return redis.NewCmdResult(int64(1), nil)
+}
+
+// rwlock emulates the RWLock scripts but RWLockRelease on the sorted set at
+// key, it must be called with c.mu held.
+func (c *Client) rwlock(s, key, arg string, ms, ttl int64, now time.Time) *redis.Cmd {
+	e, ok := c.get(key, now)
+	if ok && e.zset == nil {
+		return redis.NewCmdResult(nil, errWrongType)
+	}
+	if !ok {
+		e = entry{zset: make(map[string]float64)}
+	}
+	if s == script.RWLockRenew {
+		if _, held := e.zset[arg]; !ok || !held {
+			return redis.NewCmdResult(int64(0), nil)
+		}
+		e.zset[arg] = float64(ms)
+		e.expireAt = now.Add(time.Duration(ttl) * time.Millisecond)
+		c.entries[key] = e
+		return redis.NewCmdResult(int64(1), nil)
+	}
+
+	for m, score := range e.zset {
+		if score <= float64(ms-ttl) {
+			delete(e.zset, m)
+		}
+	}
+	reader, writer := "r:"+arg, "w:"+arg
+	granted := false
+	switch s {
+	case script.RWLockRead:
+		granted = true
+		for m := range e.zset {
+			if strings.HasPrefix(m, "w:") && m != writer {
+				granted = false
+			}
+		}
+		if granted {
+			e.zset[reader] = float64(ms)
+		}
+	case script.RWLockWrite:
+		_, own := e.zset[writer]
+		if len(e.zset) == 0 || (len(e.zset) == 1 && own) {
+			granted = true
+			e.zset[writer] = float64(ms)
+		}
+	case script.RWLockUpgrade:
+		if _, own := e.zset[reader]; own && len(e.zset) == 1 {
+			granted = true
+			delete(e.zset, reader)
+			e.zset[writer] = float64(ms)
+		}
+	}
+	if granted {
+		e.expireAt = now.Add(time.Duration(ttl) * time.Millisecond)
+	}
+	if len(e.zset) == 0 {
+		delete(c.entries, key)
+	} else {
+		c.entries[key] = e
+	}
+	if granted {
+		return redis.NewCmdResult(int64(1), nil)
+	}
+	return redis.NewCmdResult(int64(0), nil)
+}
+
+// Get returns the value of key, redis.Nil if it does not exist.
+func (c *Client) Get(key string) *redis.StringCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.get(key, time.Now())
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	if !e.str() {
+		return redis.NewStringResult("", errWrongType)
+	}
+	return redis.NewStringResult(e.value, nil)
+}
+
+// Exists returns how many of keys exist.
+func (c *Client) Exists(keys ...string) *redis.IntCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	var n int64
+	for _, key := range keys {
+		if _, ok := c.get(key, now); ok {
+			n++
+		}
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+// PTTL returns the remaining ttl of key like go-redis does:
+// -2 if the key does not exist, -1 if it has no expiry.
+func (c *Client) PTTL(key string) *redis.DurationCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	e, ok := c.get(key, now)
+	if !ok {
+		return redis.NewDurationResult(-2, nil)
+	}
+	if e.expireAt.IsZero() {
+		return redis.NewDurationResult(-1, nil)
+	}
+	return redis.NewDurationResult(e.expireAt.Sub(now).Truncate(time.Millisecond), nil)
+}
+
+// Del removes keys and returns how many existed.
+func (c *Client) Del(keys ...string) *redis.IntCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	var n int64
+	for _, key := range keys {
+		if _, ok := c.get(key, now); ok {
+			delete(c.entries, key)
+			n++
+		}
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+// Incr increments the integer at key by one, a missing key counts as zero.
+func (c *Client) Incr(key string) *redis.IntCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.get(key, time.Now())
+	if ok && !e.str() {
+		return redis.NewIntResult(0, errWrongType)
+	}
+	var n int64
+	if ok {
+		var err error
+		n, err = strconv.ParseInt(e.value, 10, 64)
+		if err != nil {
+			return redis.NewIntResult(0, errors.New("ERR value is not an integer or out of range"))
+		}
+	}
+	n++
+	e.value = strconv.FormatInt(n, 10)
+	c.entries[key] = e
+	return redis.NewIntResult(n, nil)
+}
+
+// SAdd adds members to the set at key and returns how many were new.
+func (c *Client) SAdd(key string, members ...interface{}) *redis.IntCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.get(key, time.Now())
+	if ok && e.set == nil {
+		return redis.NewIntResult(0, errWrongType)
+	}
+	if !ok {
+		e = entry{set: make(map[string]struct{})}
+	}
+	var n int64
+	for _, member := range members {
+		m := toString(member)
+		if _, ok := e.set[m]; !ok {
+			e.set[m] = struct{}{}
+			n++
+		}
+	}
+	c.entries[key] = e
+	return redis.NewIntResult(n, nil)
+}
+
+// SRem removes members from the set at key and returns how many were removed.
+func (c *Client) SRem(key string, members ...interface{}) *redis.IntCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.get(key, time.Now())
+	if !ok {
+		return redis.NewIntResult(0, nil)
+	}
+	if e.set == nil {
+		return redis.NewIntResult(0, errWrongType)
+	}
+	var n int64
+	for _, member := range members {
+		m := toString(member)
+		if _, ok := e.set[m]; ok {
+			delete(e.set, m)
+			n++
+		}
+	}
+	if len(e.set) == 0 {
+		delete(c.entries, key)
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+// SScan returns all members of the set at key in one batch, match and count are ignored.
+func (c *Client) SScan(key string, cursor uint64, match string, count int64) *redis.ScanCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.get(key, time.Now())
+	if !ok {
+		return redis.NewScanCmdResult(nil, 0, nil)
+	}
+	if e.set == nil {
+		return redis.NewScanCmdResult(nil, 0, errWrongType)
+	}
+	members := make([]string, 0, len(e.set))
+	for m := range e.set {
+		members = append(members, m)
+	}
+	return redis.NewScanCmdResult(members, 0, nil)
+}
+
+// Scan returns all keys matching match in one batch, count is ignored. match
+// supports *, ? and backslash escapes, not character classes.
+func (c *Client) Scan(cursor uint64, match string, count int64) *redis.ScanCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	var keys []string
+	for key := range c.entries {
+		if _, ok := c.get(key, now); ok && (match == "" || glob(match, key)) {
+			keys = append(keys, key)
+		}
+	}
+	return redis.NewScanCmdResult(keys, 0, nil)
+}
+
+// glob reports whether s matches pattern.
+func glob(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if glob(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+// toString formats value the way go-redis writes it onto the wire.
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprint(v)
+	}
+}
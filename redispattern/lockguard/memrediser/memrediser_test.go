@@ -0,0 +1,233 @@
+package memrediser
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/fakerediser"
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/script"
+)
+
+func TestSetNX(t *testing.T) {
+	c := New()
+	defer c.Close()
+
+	if ok, _ := c.SetNX("k", "a", 0).Result(); !ok {
+		t.Fatal("first SetNX should succeed")
+	}
+	if ok, _ := c.SetNX("k", "b", 0).Result(); ok {
+		t.Fatal("second SetNX should fail")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	c := New(WithSweepInterval(5 * time.Millisecond))
+	defer c.Close()
+
+	if ok, _ := c.Expire("k", time.Second).Result(); ok {
+		t.Fatal("Expire on a missing key should fail")
+	}
+	c.SetNX("k", "a", time.Hour)
+	if ok, _ := c.Expire("k", 10*time.Millisecond).Result(); !ok {
+		t.Fatal("Expire on an existing key should succeed")
+	}
+	time.Sleep(30 * time.Millisecond)
+	c.mu.Lock()
+	n := len(c.entries)
+	c.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("sweeper left %d keys, want 0", n)
+	}
+	if ok, _ := c.SetNX("k", "b", 0).Result(); !ok {
+		t.Fatal("SetNX after expiry should succeed")
+	}
+}
+
+func TestEval(t *testing.T) {
+	c := New()
+	defer c.Close()
+
+	tests := [...]struct {
+		Value string
+		Want  int64
+	}{
+		0: {
+			"other",
+			0,
+		},
+		1: {
+			"mine",
+			1,
+		},
+		2: {
+			"mine",
+			0,
+		},
+	}
+	c.SetNX("k", "mine", 0)
+	for _, test := range tests {
+		got, err := c.Eval(script.LockGuardDel, []string{"k"}, test.Value).Int64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.Want {
+			t.Errorf("value: %s, want: %d, got: %d", test.Value, test.Want, got)
+		}
+	}
+	if err := c.Eval("return 1", nil).Err(); err == nil {
+		t.Error("unknown script should fail")
+	}
+}
+
+func TestPTTL(t *testing.T) {
+	c := New()
+	defer c.Close()
+
+	c.SetNX("forever", "a", 0)
+	c.SetNX("soon", "a", time.Minute)
+	tests := [...]struct {
+		Key  string
+		Want time.Duration
+	}{
+		0: {
+			"missing",
+			-2,
+		},
+		1: {
+			"forever",
+			-1,
+		},
+	}
+	for _, test := range tests {
+		if got := c.PTTL(test.Key).Val(); got != test.Want {
+			t.Errorf("key: %s, want: %d, got: %d", test.Key, test.Want, got)
+		}
+	}
+	if got := c.PTTL("soon").Val(); got <= 0 || got > time.Minute {
+		t.Errorf("key: soon, got: %s, want within (0, 1m]", got)
+	}
+}
+
+func TestZSet(t *testing.T) {
+	c := New()
+	defer c.Close()
+
+	members := []*redis.Z{{Score: 2, Member: "b"}, {Score: 1, Member: "a"}, {Score: 3, Member: "c"}}
+	if n, _ := c.ZAdd("z", members...).Result(); n != 3 {
+		t.Errorf("added: %d, want: 3", n)
+	}
+	if n, _ := c.ZAdd("z", &redis.Z{Score: 4, Member: "a"}).Result(); n != 0 {
+		t.Errorf("added: %d, want: 0 on update", n)
+	}
+	if score, _ := c.ZScore("z", "a").Result(); score != 4 {
+		t.Errorf("score: %v, want: 4", score)
+	}
+	if err := c.ZScore("z", "x").Err(); err != redis.Nil {
+		t.Errorf("want: %v, got: %v", redis.Nil, err)
+	}
+	tests := [...]struct {
+		Opt  redis.ZRangeBy
+		Want []string
+	}{
+		0: {
+			redis.ZRangeBy{Min: "-inf", Max: "+inf"},
+			[]string{"b", "c", "a"},
+		},
+		1: {
+			redis.ZRangeBy{Min: "(2", Max: "4"},
+			[]string{"c", "a"},
+		},
+		2: {
+			redis.ZRangeBy{Min: "-inf", Max: "+inf", Offset: 1, Count: 1},
+			[]string{"c"},
+		},
+	}
+	for i, test := range tests {
+		opt := test.Opt
+		if got, _ := c.ZRangeByScore("z", &opt).Result(); !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("%d: want: %v, got: %v", i, test.Want, got)
+		}
+	}
+	c.ZRem("z", "a", "b", "c")
+	if n, _ := c.Exists("z").Result(); n != 0 {
+		t.Error("an empty sorted set should be removed")
+	}
+	c.Set("s", "v", 0)
+	if err := c.ZAdd("s", &redis.Z{Score: 1, Member: "a"}).Err(); err != errWrongType {
+		t.Errorf("want: %v, got: %v", errWrongType, err)
+	}
+}
+
+func TestSetExpires(t *testing.T) {
+	c := New()
+	defer c.Close()
+
+	c.Set("k", "a", 10*time.Millisecond)
+	if v, _ := c.Get("k").Result(); v != "a" {
+		t.Fatalf("value: %q, want: a", v)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := c.Get("k").Err(); err != redis.Nil {
+		t.Errorf("want: %v, got: %v", redis.Nil, err)
+	}
+}
+
+// TestConformance 对比 memrediser 与跑真实 Lua 的 fakerediser 的结果。
+func TestConformance(t *testing.T) {
+	mem := New()
+	defer mem.Close()
+	fake := fakerediser.New()
+	defer fake.Close()
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	tests := [...]struct {
+		Script string
+		Keys   []string
+		Args   []interface{}
+	}{
+		0:  {Script: script.LockGuardAcquireOrGet, Keys: []string{"lock"}, Args: []interface{}{"a", 1000}},
+		1:  {Script: script.LockGuardAcquireOrGet, Keys: []string{"lock"}, Args: []interface{}{"b", 1000}},
+		2:  {Script: script.LockGuardExtend, Keys: []string{"lock"}, Args: []interface{}{"b", 2000}},
+		3:  {Script: script.LockGuardExtend, Keys: []string{"lock"}, Args: []interface{}{"a", 2000}},
+		4:  {Script: script.LockGuardExtendEpoch, Keys: []string{"lock", "epoch"}, Args: []interface{}{"a", 2000, 1}},
+		5:  {Script: script.LockGuardExtendEpoch, Keys: []string{"lock", "epoch"}, Args: []interface{}{"a", 2000, 0}},
+		6:  {Script: script.LockGuardTransfer, Keys: []string{"lock"}, Args: []interface{}{"b", "c", 1000}},
+		7:  {Script: script.LockGuardTransfer, Keys: []string{"lock"}, Args: []interface{}{"a", "c", 1000}},
+		8:  {Script: script.LockGuardDel, Keys: []string{"lock"}, Args: []interface{}{"a"}},
+		9:  {Script: script.LockGuardDel, Keys: []string{"lock"}, Args: []interface{}{"c"}},
+		10: {Script: script.LockGuardJoinWait, Keys: []string{"wait"}, Args: []interface{}{2, 1000}},
+		11: {Script: script.LockGuardJoinWait, Keys: []string{"wait"}, Args: []interface{}{2, 1000}},
+		12: {Script: script.LockGuardJoinWait, Keys: []string{"wait"}, Args: []interface{}{2, 1000}},
+		13: {Script: script.LockGuardLeaveWait, Keys: []string{"wait"}},
+		14: {Script: script.LockGuardLeaveWait, Keys: []string{"wait"}},
+		15: {Script: script.LockGuardLeaveWait, Keys: []string{"wait"}},
+		16: {Script: script.RWLockRead, Keys: []string{"rw"}, Args: []interface{}{"a", now, 1000}},
+		17: {Script: script.RWLockRead, Keys: []string{"rw"}, Args: []interface{}{"b", now, 1000}},
+		18: {Script: script.RWLockWrite, Keys: []string{"rw"}, Args: []interface{}{"c", now, 1000}},
+		19: {Script: script.RWLockUpgrade, Keys: []string{"rw"}, Args: []interface{}{"a", now, 1000}},
+		20: {Script: script.RWLockRelease, Keys: []string{"rw"}, Args: []interface{}{"r:b"}},
+		21: {Script: script.RWLockUpgrade, Keys: []string{"rw"}, Args: []interface{}{"a", now, 1000}},
+		22: {Script: script.RWLockRead, Keys: []string{"rw"}, Args: []interface{}{"b", now, 1000}},
+		23: {Script: script.RWLockRenew, Keys: []string{"rw"}, Args: []interface{}{"w:a", now + 10, 1000}},
+		24: {Script: script.RWLockRenew, Keys: []string{"rw"}, Args: []interface{}{"r:b", now + 10, 1000}},
+		25: {Script: script.RWLockWrite, Keys: []string{"rw"}, Args: []interface{}{"c", now + 2000, 1000}},
+		26: {Script: script.RWLockRelease, Keys: []string{"rw"}, Args: []interface{}{"w:c"}},
+		27: {Script: script.RWLockRelease, Keys: []string{"rw"}, Args: []interface{}{"w:c"}},
+	}
+	for i, test := range tests {
+		want, wantErr := fake.Eval(test.Script, test.Keys, test.Args...).Result()
+		got, err := mem.Eval(test.Script, test.Keys, test.Args...).Result()
+		if (err != nil) != (wantErr != nil) || fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%d: want: %v, %v, got: %v, %v", i, want, wantErr, got, err)
+		}
+	}
+	for _, key := range []string{"lock", "epoch", "wait", "rw"} {
+		want, _ := fake.Exists(key).Result()
+		if got, _ := mem.Exists(key).Result(); got != want {
+			t.Errorf("%s exists: want: %d, got: %d", key, want, got)
+		}
+	}
+}
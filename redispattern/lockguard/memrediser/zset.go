@@ -0,0 +1,147 @@
+package memrediser
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// zget returns the sorted set at key, it must be called with c.mu held.
+func (c *Client) zget(key string, now time.Time) (entry, bool, error) {
+	e, ok := c.get(key, now)
+	if ok && e.zset == nil {
+		return entry{}, false, errWrongType
+	}
+	return e, ok, nil
+}
+
+// ZAdd adds or updates members of the sorted set at key and returns how many were new.
+func (c *Client) ZAdd(key string, members ...*redis.Z) *redis.IntCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok, err := c.zget(key, time.Now())
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	if !ok {
+		e = entry{zset: make(map[string]float64)}
+	}
+	var n int64
+	for _, z := range members {
+		m := toString(z.Member)
+		if _, ok := e.zset[m]; !ok {
+			n++
+		}
+		e.zset[m] = z.Score
+	}
+	c.entries[key] = e
+	return redis.NewIntResult(n, nil)
+}
+
+// ZRem removes members from the sorted set at key and returns how many were removed.
+func (c *Client) ZRem(key string, members ...interface{}) *redis.IntCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok, err := c.zget(key, time.Now())
+	if err != nil || !ok {
+		return redis.NewIntResult(0, err)
+	}
+	var n int64
+	for _, member := range members {
+		m := toString(member)
+		if _, ok := e.zset[m]; ok {
+			delete(e.zset, m)
+			n++
+		}
+	}
+	if len(e.zset) == 0 {
+		delete(c.entries, key)
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+// ZScore returns the score of member, redis.Nil if it is not in the set.
+func (c *Client) ZScore(key, member string) *redis.FloatCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok, err := c.zget(key, time.Now())
+	if err != nil {
+		return redis.NewFloatResult(0, err)
+	}
+	score, held := e.zset[member]
+	if !ok || !held {
+		return redis.NewFloatResult(0, redis.Nil)
+	}
+	return redis.NewFloatResult(score, nil)
+}
+
+// ZCard returns the number of members of the sorted set at key.
+func (c *Client) ZCard(key string) *redis.IntCmd {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, _, err := c.zget(key, time.Now())
+	return redis.NewIntResult(int64(len(e.zset)), err)
+}
+
+// ZRangeByScore returns the members scored within opt.Min and opt.Max,
+// ordered by score then member. Bounds may be -inf, +inf or exclusive with a
+// leading "(", a zero opt.Count means no limit.
+func (c *Client) ZRangeByScore(key string, opt *redis.ZRangeBy) *redis.StringSliceCmd {
+	min, minEx, err := parseBound(opt.Min)
+	if err != nil {
+		return redis.NewStringSliceResult(nil, err)
+	}
+	max, maxEx, err := parseBound(opt.Max)
+	if err != nil {
+		return redis.NewStringSliceResult(nil, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, _, err := c.zget(key, time.Now())
+	if err != nil {
+		return redis.NewStringSliceResult(nil, err)
+	}
+	var members []string
+	for m, score := range e.zset {
+		if (score > min || !minEx && score == min) && (score < max || !maxEx && score == max) {
+			members = append(members, m)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		a, b := e.zset[members[i]], e.zset[members[j]]
+		if a != b {
+			return a < b
+		}
+		return members[i] < members[j]
+	})
+	if opt.Offset >= int64(len(members)) {
+		return redis.NewStringSliceResult([]string{}, nil)
+	}
+	members = members[opt.Offset:]
+	if opt.Count > 0 && opt.Count < int64(len(members)) {
+		members = members[:opt.Count]
+	}
+	return redis.NewStringSliceResult(members, nil)
+}
+
+// parseBound parses a score bound of ZRangeByScore.
+func parseBound(s string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+	switch s {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, errors.New("ERR min or max is not a float")
+	}
+	return f, exclusive, nil
+}
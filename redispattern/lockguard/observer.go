@@ -0,0 +1,89 @@
+package lockguard
+
+import "time"
+
+// Logger logs warnings of a LockGuard, *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Observer observes lock events, e.g. to export metrics.
+type Observer interface {
+	// OnAcquire is called once the lock is obtained, latency is the time spent
+	// acquiring it and attempts the attempt which succeeded, starting at 1.
+	// Success after several attempts is a sign of contention.
+	OnAcquire(key string, latency time.Duration, attempts int)
+	// OnLockLost is called when renewal fails and the lock is given up.
+	OnLockLost(key string, err error)
+}
+
+// LowTTLObserver may be implemented by an Observer to be told about the
+// warnings of WithTTLCheck.
+type LowTTLObserver interface {
+	// OnLowTTL is called when the lock had only ttl left right before a renewal.
+	OnLowTTL(key string, ttl time.Duration)
+}
+
+// CancelObserver may be implemented by an Observer to tell acquisitions
+// abandoned because ctx ended from those failing on contention.
+type CancelObserver interface {
+	// OnAcquireCancelled is called when ctx ends the acquisition after
+	// attempts attempts and elapsed time, Run then returns ctx.Err().
+	OnAcquireCancelled(key string, elapsed time.Duration, attempts int)
+}
+
+func (guard *LockGuard) logf(format string, v ...interface{}) {
+	if guard.lock.logger == nil {
+		return
+	}
+	if guard.lock.instanceID != "" {
+		format += ", instance: %s"
+		v = append(v, guard.lock.instanceID)
+	}
+	guard.lock.logger.Printf(format, v...)
+}
+
+func (guard *LockGuard) onAcquire(latency time.Duration, attempts int) {
+	if guard.lock.observer != nil {
+		guard.lock.observer.OnAcquire(guard.lock.Key, latency, attempts)
+	}
+	if guard.lock.slowAcquireThreshold > 0 && latency > guard.lock.slowAcquireThreshold {
+		guard.logf("lockguard: slow acquire, key: %s, latency: %s, threshold: %s",
+			guard.lock.Key, latency, guard.lock.slowAcquireThreshold)
+	}
+}
+
+func (guard *LockGuard) onLockLost(err error) {
+	if guard.lock.observer != nil {
+		guard.lock.observer.OnLockLost(guard.lock.Key, err)
+	}
+	guard.logf("lockguard: lock lost, key: %s, err: %v", guard.lock.Key, err)
+}
+
+// watchHold warns once if the lock is still held after half of its expiration,
+// renewal keeps such a lock alive but the handler likely deserves a longer TTL.
+// The returned function stops watching.
+func (guard *LockGuard) watchHold() func() bool {
+	if guard.lock.logger == nil {
+		return func() bool { return false }
+	}
+	t := time.AfterFunc(guard.lock.expiration/2, func() {
+		guard.logf("lockguard: lock held longer than half of its expiration, key: %s, expiration: %s",
+			guard.lock.Key, guard.lock.expiration)
+	})
+	return t.Stop
+}
+
+func (guard *LockGuard) onLowTTL(ttl time.Duration) {
+	if o, ok := guard.lock.observer.(LowTTLObserver); ok {
+		o.OnLowTTL(guard.lock.Key, ttl)
+	}
+	guard.logf("lockguard: low ttl before renewal, key: %s, ttl: %s, threshold: %s",
+		guard.lock.Key, ttl, guard.lock.ttlCheckThreshold)
+}
+
+func (guard *LockGuard) onAcquireCancelled(elapsed time.Duration, attempts int) {
+	if o, ok := guard.lock.observer.(CancelObserver); ok {
+		o.OnAcquireCancelled(guard.lock.Key, elapsed, attempts)
+	}
+}
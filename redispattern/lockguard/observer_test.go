@@ -0,0 +1,126 @@
+package lockguard
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+)
+
+// syncLogger records the lines logged from any goroutine.
+type syncLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *syncLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *syncLogger) contains(s string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range l.lines {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// constantBackOff waits the same delay before every retry.
+type constantBackOff time.Duration
+
+func (b constantBackOff) NextBackOff() time.Duration {
+	return time.Duration(b)
+}
+
+func (b constantBackOff) Reset() {}
+
+func TestWithSlowAcquireThreshold(t *testing.T) {
+	tests := [...]struct {
+		Busy      int
+		Threshold time.Duration
+		WantWarn  bool
+	}{
+		0: {
+			Busy:      2,
+			Threshold: 10 * time.Millisecond,
+			WantWarn:  true,
+		},
+		1: {
+			Threshold: time.Second,
+		},
+		2: {
+			Busy: 2,
+		},
+	}
+	for i, test := range tests {
+		var buf bytes.Buffer
+		o := &lostObserver{}
+		r := &busyRediser{stubRediser: newStubRediser(true), busy: test.Busy}
+		guard, err := New(r, "lockguard:slow", WithRetryTimes(3), WithBackOff(constantBackOff(20*time.Millisecond)),
+			WithSlowAcquireThreshold(test.Threshold), WithLogger(log.New(&buf, "", 0)), WithObserver(o))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := guard.Run(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		if warned := strings.Contains(buf.String(), "slow acquire"); warned != test.WantWarn {
+			t.Errorf("%d: warned: %t, want: %t, log: %q", i, warned, test.WantWarn, buf.String())
+		}
+		if len(o.attempts) != 1 || o.attempts[0] != test.Busy+1 {
+			t.Errorf("%d: attempts: %v, want: [%d]", i, o.attempts, test.Busy+1)
+		}
+	}
+	if _, err := New(newStubRediser(true), "lockguard:slow", WithSlowAcquireThreshold(-time.Second)); err == nil {
+		t.Error("a negative threshold should be rejected")
+	}
+}
+
+func TestWatchHold(t *testing.T) {
+	tests := [...]struct {
+		Hold     time.Duration
+		WantWarn bool
+	}{
+		0: {
+			Hold:     60 * time.Millisecond,
+			WantWarn: true,
+		},
+		1: {
+			Hold: 5 * time.Millisecond,
+		},
+	}
+	mem := memrediser.New()
+	defer mem.Close()
+	for i, test := range tests {
+		logger := &syncLogger{}
+		guard, err := New(mem, "lockguard:hold", WithLogger(logger))
+		if err != nil {
+			t.Fatal(err)
+		}
+		guard.lock.expiration = 80 * time.Millisecond
+		guard.lock.renewInterval = 20 * time.Millisecond
+		err = guard.Run(context.Background(), func(ctx context.Context) error {
+			time.Sleep(test.Hold)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 停止后的定时器不应再告警.
+		time.Sleep(60 * time.Millisecond)
+		if warned := logger.contains("held longer than half"); warned != test.WantWarn {
+			t.Errorf("%d: warned: %t, want: %t, log: %q", i, warned, test.WantWarn, logger.lines)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package lockguard
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// OwnsLock reports whether the lock still holds our value, without side
+// effects. Handlers may call it to verify ownership before a critical write.
+func (guard *LockGuard) OwnsLock(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if !guard.lock.locked {
+		return false, nil
+	}
+	c, cancel := guard.client(ctx)
+	defer cancel()
+	r, ok := c.(inspector)
+	if !ok {
+		return false, fmt.Errorf("get: %w", errUnsupported)
+	}
+	guard.valueMu.Lock()
+	defer guard.valueMu.Unlock()
+	v, err := r.Get(guard.lock.Key).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return v == guard.lock.Value, nil
+}
@@ -0,0 +1,34 @@
+package lockguard
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+)
+
+func TestOwnsLock(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	guard, err := New(mem, "lockguard:owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := guard.OwnsLock(context.Background()); err != nil || ok {
+		t.Errorf("before Run: %t, %v, want: false, nil", ok, err)
+	}
+	err = guard.Run(context.Background(), func(ctx context.Context) error {
+		if ok, err := guard.OwnsLock(ctx); err != nil || !ok {
+			t.Errorf("owner: %t, %v, want: true, nil", ok, err)
+		}
+		mem.Del("lockguard:owner")
+		mem.SetNX("lockguard:owner", "other", 0)
+		if ok, err := guard.OwnsLock(ctx); err != nil || ok {
+			t.Errorf("taken over: %t, %v, want: false, nil", ok, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
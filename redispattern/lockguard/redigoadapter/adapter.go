@@ -0,0 +1,83 @@
+// Package redigoadapter lets lockguard run on a gomodule/redigo Pool, for
+// services which have not migrated to go-redis.
+package redigoadapter
+
+import (
+	"time"
+
+	goredis "github.com/go-redis/redis/v7"
+	"github.com/gomodule/redigo/redis"
+	"github.com/xiaojiaoyu100/lizard/timekit"
+)
+
+// Adapter implements the rediser of lockguard with a redigo Pool.
+type Adapter struct {
+	pool *redis.Pool
+}
+
+// New returns an Adapter using pool.
+func New(pool *redis.Pool) *Adapter {
+	return &Adapter{pool: pool}
+}
+
+// SetNX issues SET key value [PX ms] NX, zero expiration means no expiry.
+func (a *Adapter) SetNX(key string, value interface{}, expiration time.Duration) *goredis.BoolCmd {
+	conn := a.pool.Get()
+	defer conn.Close()
+	args := []interface{}{key, value}
+	if expiration > 0 {
+		args = append(args, "PX", timekit.DurationToMillis(expiration))
+	}
+	args = append(args, "NX")
+	reply, err := conn.Do("SET", args...)
+	if err != nil {
+		return goredis.NewBoolResult(false, err)
+	}
+	// A nil reply means the key already exists.
+	return goredis.NewBoolResult(reply != nil, nil)
+}
+
+// Expire issues PEXPIRE key ms.
+func (a *Adapter) Expire(key string, expiration time.Duration) *goredis.BoolCmd {
+	conn := a.pool.Get()
+	defer conn.Close()
+	ok, err := redis.Bool(conn.Do("PEXPIRE", key, timekit.DurationToMillis(expiration)))
+	return goredis.NewBoolResult(ok, err)
+}
+
+// Eval issues EVAL script numkeys key [key ...] arg [arg ...].
+func (a *Adapter) Eval(script string, keys []string, args ...interface{}) *goredis.Cmd {
+	conn := a.pool.Get()
+	defer conn.Close()
+	cmdArgs := make([]interface{}, 0, 2+len(keys)+len(args))
+	cmdArgs = append(cmdArgs, script, len(keys))
+	for _, key := range keys {
+		cmdArgs = append(cmdArgs, key)
+	}
+	cmdArgs = append(cmdArgs, args...)
+	reply, err := conn.Do("EVAL", cmdArgs...)
+	if err != nil {
+		return goredis.NewCmdResult(nil, err)
+	}
+	if reply == nil {
+		return goredis.NewCmdResult(nil, goredis.Nil)
+	}
+	return goredis.NewCmdResult(convert(reply), nil)
+}
+
+// convert maps a redigo reply to the value go-redis would return:
+// bulk strings become string, arrays are converted element-wise.
+func convert(reply interface{}) interface{} {
+	switch v := reply.(type) {
+	case []byte:
+		return string(v)
+	case []interface{}:
+		vs := make([]interface{}, len(v))
+		for i, e := range v {
+			vs[i] = convert(e)
+		}
+		return vs
+	default:
+		return v
+	}
+}
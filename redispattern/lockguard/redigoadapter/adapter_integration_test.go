@@ -0,0 +1,60 @@
+//go:build integration
+// +build integration
+
+package redigoadapter_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard"
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/redigoadapter"
+)
+
+// Run with: REDIS_ADDR=127.0.0.1:6379 go test -tags integration ./...
+func newAdapter(t *testing.T) (*redigoadapter.Adapter, *redis.Pool) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "127.0.0.1:6379"
+	}
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr)
+		},
+	}
+	conn := pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("PING"); err != nil {
+		t.Skipf("redis is not reachable at %s: %v", addr, err)
+	}
+	return redigoadapter.New(pool), pool
+}
+
+func TestAdapterRun(t *testing.T) {
+	adapter, pool := newAdapter(t)
+	defer pool.Close()
+	key := "lizard:redigoadapter:test"
+
+	guard, err := lockguard.New(adapter, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = guard.Run(context.Background(), func(ctx context.Context) error {
+		if ok, err := adapter.SetNX(key, "other", time.Second).Result(); err != nil || ok {
+			t.Errorf("SetNX while locked: %t, %v, want: false, nil", ok, err)
+		}
+		if ok, err := guard.TryExtend(ctx, time.Minute); err != nil || !ok {
+			t.Errorf("TryExtend: %t, %v, want: true, nil", ok, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := adapter.SetNX(key, "other", time.Second).Result(); err != nil || !ok {
+		t.Errorf("SetNX after Run: %t, %v, want: true, nil", ok, err)
+	}
+}
@@ -10,10 +10,74 @@ var (
 	_ rediser = (*redis.Client)(nil)
 	_ rediser = (*redis.Ring)(nil)
 	_ rediser = (*redis.ClusterClient)(nil)
+
+	_ tagRediser = (*redis.Client)(nil)
+	_ tagRediser = (*redis.Ring)(nil)
+	_ tagRediser = (*redis.ClusterClient)(nil)
+
+	_ inspector = (*redis.Client)(nil)
+	_ inspector = (*redis.Ring)(nil)
+	_ inspector = (*redis.ClusterClient)(nil)
+
+	_ scanner = (*redis.Client)(nil)
+	_ scanner = (*redis.Ring)(nil)
+	_ scanner = (*redis.ClusterClient)(nil)
+
+	_ pipeliner = (*redis.Client)(nil)
+	_ pipeliner = (*redis.Ring)(nil)
+	_ pipeliner = (*redis.ClusterClient)(nil)
+
+	_ fencer = (*redis.Client)(nil)
+	_ fencer = (*redis.Ring)(nil)
+	_ fencer = (*redis.ClusterClient)(nil)
 )
 
+// rediser is the minimal set of commands a client must implement for New
+// and Run. The *redis.Client, *redis.Ring and *redis.ClusterClient of
+// go-redis implement every interface of this file, custom clients and
+// adapters only need rediser for the basic lock.
+//
+// Features needing more commands type-assert the client to one of the
+// optional interfaces below and fail with an error wrapping errUnsupported
+// when it does not implement it, so that widening what lockguard can do
+// never breaks the build of existing implementations. go-redis v7 has no
+// per-command context, so none of the interfaces take one.
 type rediser interface {
 	SetNX(key string, value interface{}, expiration time.Duration) *redis.BoolCmd
 	Eval(script string, keys []string, args ...interface{}) *redis.Cmd
 	Expire(key string, expiration time.Duration) *redis.BoolCmd
 }
+
+// tagRediser is needed by WithTag and ForceUnlockByTag.
+type tagRediser interface {
+	rediser
+	SAdd(key string, members ...interface{}) *redis.IntCmd
+	SRem(key string, members ...interface{}) *redis.IntCmd
+	SScan(key string, cursor uint64, match string, count int64) *redis.ScanCmd
+	Del(keys ...string) *redis.IntCmd
+}
+
+// inspector is the read and delete surface needed by OwnsLock and the
+// inspection helpers.
+type inspector interface {
+	Get(key string) *redis.StringCmd
+	Exists(keys ...string) *redis.IntCmd
+	Del(keys ...string) *redis.IntCmd
+	PTTL(key string) *redis.DurationCmd
+}
+
+// scanner is needed by ListLocks.
+type scanner interface {
+	inspector
+	Scan(cursor uint64, match string, count int64) *redis.ScanCmd
+}
+
+// pipeliner is needed by NewRenewer.
+type pipeliner interface {
+	Pipeline() redis.Pipeliner
+}
+
+// fencer is needed by WithFencingToken.
+type fencer interface {
+	Incr(key string) *redis.IntCmd
+}
@@ -0,0 +1,118 @@
+package lockguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/xiaojiaoyu100/lizard/backoff"
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/script"
+	"github.com/xiaojiaoyu100/lizard/timekit"
+)
+
+const extendLuaScript = script.LockGuardExtend
+
+// renewPanicked reports a panic recovered from renewTTL, e.g. from a nil
+// client or a buggy adapter, as a lost lock instead of crashing the process.
+// The panic value and its stack are logged, the lost lock error carries the
+// value as a *RenewPanicError.
+func (guard *LockGuard) renewPanicked(value interface{}) {
+	guard.logf("lockguard: renewal panicked, key: %s, panic: %+v\n%s", guard.lock.Key, value, debug.Stack())
+	guard.onLockLost(fmt.Errorf("key: %s, err: %w", guard.lock.Key, &RenewPanicError{Value: value}))
+}
+
+// renewTTL extends the lock and reports whether renewal should go on.
+// Errors are retried with a tight backoff while the lock has ttl left,
+// so that a single network blip does not drop a healthy lock.
+func (guard *LockGuard) renewTTL() bool {
+	guard.checkTTL()
+	deadline := guard.renewedAt.Add(guard.lock.expiration)
+	b := backoff.NewStrategyBackOff(backoff.ExponentialBackoffFullJitterStrategy{
+		ExponentialBackoff: backoff.ExponentialBackoff{
+			Base: 10 * time.Millisecond,
+			Cap:  100 * time.Millisecond,
+		}})
+	for i := 0; ; i++ {
+		now := time.Now()
+		ok, err := guard.extend(context.Background(), guard.lock.expiration)
+		if err == nil {
+			if !ok {
+				guard.onLockLost(fmt.Errorf("key: %s, err: %w", guard.lock.Key, errLockLost))
+				return false
+			}
+			guard.renewedAt = now
+			guard.renewTag()
+			return true
+		}
+		if IsEpochRegressed(err) {
+			// 不重试，以区别于普通的锁丢失上报给observer.
+			guard.onLockLost(err)
+			return false
+		}
+		d := b.NextBackOff()
+		if i >= guard.lock.renewRetries || time.Until(deadline) <= d {
+			guard.onLockLost(fmt.Errorf("key: %s, err: %v: %w", guard.lock.Key, err, errLockLost))
+			return false
+		}
+		time.Sleep(d)
+	}
+}
+
+// TryExtend sets the ttl of the lock to d without blocking, it returns false
+// if the lock is no longer ours. A handler may call it at a checkpoint to
+// confirm it still holds the lock and bail out cleanly if it does not.
+func (guard *LockGuard) TryExtend(ctx context.Context, d time.Duration) (bool, error) {
+	if d <= 0 {
+		return false, errors.New("extension is not positive")
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if !guard.lock.locked {
+		return false, nil
+	}
+	return guard.extend(ctx, d)
+}
+
+// extend sets the ttl of the lock to d if it is still ours.
+func (guard *LockGuard) extend(ctx context.Context, d time.Duration) (bool, error) {
+	r, cancel := guard.client(ctx)
+	defer cancel()
+	guard.valueMu.Lock()
+	defer guard.valueMu.Unlock()
+	ms := timekit.DurationToMillis(d)
+	if guard.lock.epochCheck {
+		return guard.extendEpoch(r, ms)
+	}
+	keys := []string{guard.lock.Key}
+	n, err := r.Eval(extendLuaScript, keys, guard.lock.Value, ms).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// checkTTL warns if the lock is close to expiring right before it is renewed,
+// a sign that renewals do not keep up, e.g. because of GC pauses or a slow
+// redis. It only reads the ttl every ttlCheckEvery renewals.
+func (guard *LockGuard) checkTTL() {
+	if guard.lock.ttlCheckEvery == 0 {
+		return
+	}
+	guard.renewals++
+	if guard.renewals%guard.lock.ttlCheckEvery != 0 {
+		return
+	}
+	r, cancel := guard.client(context.Background())
+	defer cancel()
+	ttl, err := r.(inspector).PTTL(guard.lock.Key).Result()
+	if err != nil || ttl < 0 {
+		// 读取失败或锁已不存在，交给续期本身处理.
+		return
+	}
+	if ttl < guard.lock.ttlCheckThreshold {
+		guard.onLowTTL(ttl)
+	}
+}
@@ -0,0 +1,317 @@
+package lockguard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+)
+
+// flakyRediser fails the first failures renewals.
+type flakyRediser struct {
+	*memrediser.Client
+	failures int
+}
+
+func (f *flakyRediser) Eval(script string, keys []string, args ...interface{}) *redis.Cmd {
+	if script == extendLuaScript && f.failures > 0 {
+		f.failures--
+		return redis.NewCmdResult(nil, errors.New("i/o timeout"))
+	}
+	return f.Client.Eval(script, keys, args...)
+}
+
+func TestRenewTTLRetries(t *testing.T) {
+	tests := [...]struct {
+		Failures int
+		Retries  int
+		Want     bool
+	}{
+		0: {
+			0,
+			0,
+			true,
+		},
+		1: {
+			2,
+			2,
+			true,
+		},
+		2: {
+			3,
+			2,
+			false,
+		},
+	}
+	for _, test := range tests {
+		mem := memrediser.New()
+		r := &flakyRediser{Client: mem, failures: test.Failures}
+		guard, err := New(r, "lockguard:renew", WithRenewRetries(test.Retries))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := guard.genValue(); err != nil {
+			t.Fatal(err)
+		}
+		guard.obtain(context.Background())
+		if got := guard.renewTTL(); got != test.Want {
+			t.Errorf("failures: %d, retries: %d, want: %t, got: %t", test.Failures, test.Retries, test.Want, got)
+		}
+		mem.Close()
+	}
+}
+
+// renewCountingRediser counts the renewals and fails the first failures.
+type renewCountingRediser struct {
+	*memrediser.Client
+	renewals int32
+	failures int32
+}
+
+func (r *renewCountingRediser) Eval(script string, keys []string, args ...interface{}) *redis.Cmd {
+	if script == extendLuaScript {
+		atomic.AddInt32(&r.renewals, 1)
+		if atomic.AddInt32(&r.failures, -1) >= 0 {
+			return redis.NewCmdResult(nil, errors.New("i/o timeout"))
+		}
+	}
+	return r.Client.Eval(script, keys, args...)
+}
+
+func TestWithRenew(t *testing.T) {
+	for i, setter := range []Setter{
+		WithRenew(0, 0),
+		WithRenew(time.Second, -0.1),
+		WithRenew(time.Second, 1),
+		// 默认过期时间为30s.
+		WithRenew(30*time.Second, 0),
+		WithRenew(time.Minute, 0),
+	} {
+		if _, err := New(newStubRediser(true), "lockguard:renew:config", setter); err == nil {
+			t.Errorf("%d: want the config rejected", i)
+		}
+	}
+
+	tests := [...]struct {
+		Setters      []Setter
+		Failures     int32
+		WantRenewals int32 // at least
+		WantLost     bool
+	}{
+		0: {},
+		1: {
+			Setters:      []Setter{WithRenew(10*time.Millisecond, 0)},
+			WantRenewals: 4,
+		},
+		2: {
+			Setters:      []Setter{WithRenew(10*time.Millisecond, 0), WithRenewRetries(1)},
+			Failures:     1,
+			WantRenewals: 4,
+		},
+		3: {
+			Setters:      []Setter{WithRenew(10*time.Millisecond, 0), WithRenewRetries(0)},
+			Failures:     1,
+			WantRenewals: 1,
+			WantLost:     true,
+		},
+	}
+	for i, test := range tests {
+		mem := memrediser.New()
+		r := &renewCountingRediser{Client: mem, failures: test.Failures}
+		o := &chanObserver{lost: make(chan error, 1)}
+		guard, err := New(r, "lockguard:renew:interval", append(test.Setters, WithObserver(o))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = guard.Run(context.Background(), func(ctx context.Context) error {
+			time.Sleep(60 * time.Millisecond)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		renewals := atomic.LoadInt32(&r.renewals)
+		if test.WantRenewals == 0 && renewals != 0 || renewals < test.WantRenewals {
+			t.Errorf("%d: renewals: %d, want at least: %d", i, renewals, test.WantRenewals)
+		}
+		if test.WantLost && renewals != 1 {
+			t.Errorf("%d: renewals: %d, want none after the lock is lost", i, renewals)
+		}
+		if lost := len(o.lost) == 1; lost != test.WantLost {
+			t.Errorf("%d: lost: %t, want: %t", i, lost, test.WantLost)
+		}
+		mem.Close()
+	}
+}
+
+func TestRenewTTLLost(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	guard, err := New(mem, "lockguard:lost", WithRetryTimes(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := guard.genValue(); err != nil {
+		t.Fatal(err)
+	}
+	guard.obtain(context.Background())
+	mem.Del("lockguard:lost")
+	mem.SetNX("lockguard:lost", "other", time.Minute)
+	if guard.renewTTL() {
+		t.Error("renewal should stop once another owner holds the key")
+	}
+}
+
+func TestTryExtend(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	guard, err := New(mem, "lockguard:extend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = guard.Run(context.Background(), func(ctx context.Context) error {
+		if ok, err := guard.TryExtend(ctx, time.Minute); err != nil || !ok {
+			t.Errorf("owner extend: %t, %v, want: true, nil", ok, err)
+		}
+		mem.Del("lockguard:extend")
+		if ok, err := guard.TryExtend(ctx, time.Minute); err != nil || ok {
+			t.Errorf("lost extend: %t, %v, want: false, nil", ok, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// panicRediser panics whenever the lock is renewed.
+type panicRediser struct {
+	*memrediser.Client
+}
+
+func (p *panicRediser) Expire(key string, expiration time.Duration) *redis.BoolCmd {
+	panic("expire exploded")
+}
+
+func (p *panicRediser) Eval(script string, keys []string, args ...interface{}) *redis.Cmd {
+	if script == extendLuaScript {
+		panic("pexpire exploded")
+	}
+	return p.Client.Eval(script, keys, args...)
+}
+
+// lostObserver records lost locks and the attempts of acquisitions.
+type lostObserver struct {
+	lost     []error
+	attempts []int
+}
+
+func (o *lostObserver) OnAcquire(key string, latency time.Duration, attempts int) {
+	o.attempts = append(o.attempts, attempts)
+}
+
+func (o *lostObserver) OnLockLost(key string, err error) {
+	o.lost = append(o.lost, err)
+}
+
+func TestRenewRecoversPanic(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	o := &lostObserver{}
+	var buf bytes.Buffer
+	guard, err := New(&panicRediser{Client: mem}, "lockguard:panic", WithObserver(o), WithLogger(log.New(&buf, "", 0)),
+		WithRenew(5*time.Millisecond, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 续期panic后Run继续运行handler，并在结束后释放锁.
+	err = guard.Run(context.Background(), func(ctx context.Context) error {
+		time.Sleep(30 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(o.lost) != 1 || !errors.Is(o.lost[0], errLockLost) {
+		t.Fatalf("lost: %v, want one lock lost event", o.lost)
+	}
+	var p *RenewPanicError
+	if !errors.As(o.lost[0], &p) || p.Value != "pexpire exploded" {
+		t.Errorf("lost: %v, want the panic value exposed", o.lost[0])
+	}
+	if !strings.Contains(buf.String(), "renewal panicked") || !strings.Contains(buf.String(), "pexpire exploded") ||
+		!strings.Contains(buf.String(), "goroutine") {
+		t.Errorf("log: %q, want the panic and its stack", buf.String())
+	}
+	if ok, _ := mem.SetNX("lockguard:panic", "other", 0).Result(); !ok {
+		t.Error("lock should be released after the renewal panic")
+	}
+}
+
+// lowTTLObserver records low ttl warnings.
+type lowTTLObserver struct {
+	lostObserver
+	ttls []time.Duration
+}
+
+func (o *lowTTLObserver) OnLowTTL(key string, ttl time.Duration) {
+	o.ttls = append(o.ttls, ttl)
+}
+
+func TestWithTTLCheck(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	o := &lowTTLObserver{}
+	guard, err := New(mem, "lockguard:ttlcheck", WithObserver(o), WithTTLCheck(2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := guard.genValue(); err != nil {
+		t.Fatal(err)
+	}
+	guard.obtain(context.Background())
+	for i := 0; i < 2; i++ {
+		mem.Expire("lockguard:ttlcheck", time.Second)
+		if !guard.renewTTL() {
+			t.Fatal("renewal failed")
+		}
+	}
+	if len(o.ttls) != 1 || o.ttls[0] > time.Second {
+		t.Errorf("low ttls: %v, want one warning at most 1s", o.ttls)
+	}
+}
+
+func TestRenewerRenewsTag(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	p := &memPipeliner{Client: mem}
+	renewer, err := NewRenewer(p, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer renewer.Close()
+	guard, err := New(p, "lockguard:renewer:tagged", WithRenewer(renewer), WithTag("batch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	guard.lock.expiration = 30 * time.Millisecond
+
+	err = guard.Run(context.Background(), func(ctx context.Context) error {
+		// 标签集合须随锁一同续期.
+		time.Sleep(100 * time.Millisecond)
+		if n, _ := mem.Exists(tagKey("batch")).Result(); n != 1 {
+			t.Error("tag set expired while the lock was renewed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,152 @@
+package lockguard
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/timekit"
+)
+
+// Renewer renews every lock of the guards created with WithRenewer on one
+// shared ticker, pipelining the renewals of a tick into a single round trip.
+// A process holding hundreds of locks then spends one goroutine and one timer
+// on renewal instead of one each per lock. Each renewal still only extends a
+// lock which holds the value of its guard.
+//
+// The locks must live on the redis the Renewer is created with, renewal
+// retries and WithTTLCheck do not apply to them.
+type Renewer struct {
+	redis    pipeliner
+	interval time.Duration
+
+	mu     sync.Mutex
+	guards map[*LockGuard]uint64 // the generation of each add
+	gen    uint64
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewRenewer returns a Renewer ticking every interval, it must be shorter
+// than the expiration of every guard using it. Call Close to stop it.
+func NewRenewer(redis pipeliner, interval time.Duration) (*Renewer, error) {
+	if interval <= 0 {
+		return nil, errors.New("renew interval is not positive")
+	}
+	r := &Renewer{
+		redis:    redis,
+		interval: interval,
+		guards:   make(map[*LockGuard]uint64),
+		done:     make(chan struct{}),
+	}
+	go r.loop()
+	return r, nil
+}
+
+// Close stops renewing, locks still held then expire on their own.
+func (r *Renewer) Close() {
+	r.once.Do(func() {
+		close(r.done)
+	})
+}
+
+func (r *Renewer) loop() {
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			r.tick()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *Renewer) add(guard *LockGuard) {
+	r.mu.Lock()
+	r.gen++
+	r.guards[guard] = r.gen
+	r.mu.Unlock()
+}
+
+// remove does not wait for a renewal of guard in flight, its result is
+// dropped as guard is no longer added, or added again by another Run.
+func (r *Renewer) remove(guard *LockGuard) {
+	r.mu.Lock()
+	delete(r.guards, guard)
+	r.mu.Unlock()
+}
+
+// renewal is a guard renewed by a tick.
+type renewal struct {
+	guard *LockGuard
+	gen   uint64
+	cmd   *redis.Cmd
+}
+
+func (r *Renewer) tick() {
+	// 只在复制guard列表时持锁，网络往返期间不阻塞add与remove.
+	r.mu.Lock()
+	renewals := make([]renewal, 0, len(r.guards))
+	for guard, gen := range r.guards {
+		renewals = append(renewals, renewal{guard: guard, gen: gen})
+	}
+	r.mu.Unlock()
+	if len(renewals) == 0 {
+		return
+	}
+
+	pipe := r.redis.Pipeline()
+	defer pipe.Close()
+	// 同一标签集合只续期一次，取最长的过期时间.
+	tags := make(map[string]*LockGuard)
+	for i := range renewals {
+		guard := renewals[i].guard
+		guard.valueMu.Lock()
+		value := guard.lock.Value
+		guard.valueMu.Unlock()
+		keys := []string{guard.lock.Key}
+		renewals[i].cmd = pipe.Eval(extendLuaScript, keys, value, timekit.DurationToMillis(guard.lock.expiration))
+		if tag := guard.lock.tag; tag != "" {
+			if g, ok := tags[tag]; !ok || g.lock.expiration < guard.lock.expiration {
+				tags[tag] = guard
+			}
+		}
+	}
+	tagCmds := make(map[*LockGuard]*redis.BoolCmd, len(tags))
+	for tag, guard := range tags {
+		tagCmds[guard] = pipe.Expire(tagKey(tag), guard.lock.expiration)
+	}
+	// 各命令的错误分别检查.
+	_, _ = pipe.Exec()
+
+	for guard, cmd := range tagCmds {
+		if err := cmd.Err(); err != nil {
+			guard.logf("lockguard: renew tag failed, key: %s, tag: %s, err: %v", guard.lock.Key, guard.lock.tag, err)
+		}
+	}
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, renewal := range renewals {
+		guard := renewal.guard
+		if gen, ok := r.guards[guard]; !ok || gen != renewal.gen {
+			continue
+		}
+		n, err := renewal.cmd.Int64()
+		switch {
+		case err == nil && n == 1:
+			guard.renewedAt = now
+		case err == nil:
+			delete(r.guards, guard)
+			guard.onLockLost(fmt.Errorf("key: %s, err: %w", guard.lock.Key, errLockLost))
+		case !now.Before(guard.renewedAt.Add(guard.lock.expiration)):
+			// 出错但重试已无意义，锁已过期.
+			delete(r.guards, guard)
+			guard.onLockLost(fmt.Errorf("key: %s, err: %v: %w", guard.lock.Key, err, errLockLost))
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package lockguard
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+)
+
+// memPipeliner pipelines onto memrediser, commands run as they are queued.
+// Exec blocks while block is not nil and open.
+type memPipeliner struct {
+	*memrediser.Client
+	execs int32
+	block chan struct{}
+}
+
+func (m *memPipeliner) Pipeline() redis.Pipeliner {
+	return &memPipe{m: m}
+}
+
+type memPipe struct {
+	redis.Pipeliner
+	m *memPipeliner
+}
+
+func (p *memPipe) Eval(script string, keys []string, args ...interface{}) *redis.Cmd {
+	return p.m.Client.Eval(script, keys, args...)
+}
+
+func (p *memPipe) Expire(key string, expiration time.Duration) *redis.BoolCmd {
+	return p.m.Client.Expire(key, expiration)
+}
+
+func (p *memPipe) Exec() ([]redis.Cmder, error) {
+	atomic.AddInt32(&p.m.execs, 1)
+	if p.m.block != nil {
+		<-p.m.block
+	}
+	return nil, nil
+}
+
+func (p *memPipe) Close() error {
+	return nil
+}
+
+// chanObserver signals lost locks.
+type chanObserver struct {
+	lost chan error
+}
+
+func (o *chanObserver) OnAcquire(key string, latency time.Duration, attempts int) {}
+
+func (o *chanObserver) OnLockLost(key string, err error) {
+	o.lost <- err
+}
+
+func TestRenewerRenewsInOnePipeline(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	p := &memPipeliner{Client: mem}
+	renewer, err := NewRenewer(p, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer renewer.Close()
+
+	keys := []string{"lockguard:renewer:1", "lockguard:renewer:2", "lockguard:renewer:3"}
+	guards := make([]*LockGuard, len(keys))
+	for i, key := range keys {
+		if guards[i], err = New(p, key, WithRenewer(renewer)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	done := make(chan error, len(guards))
+	for _, guard := range guards {
+		go func(guard *LockGuard) {
+			done <- guard.Run(context.Background(), func(ctx context.Context) error {
+				time.Sleep(30 * time.Millisecond)
+				return nil
+			})
+		}(guard)
+	}
+	for range guards {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if execs := atomic.LoadInt32(&p.execs); execs == 0 {
+		t.Error("no renewal while the locks were held")
+	}
+	renewer.mu.Lock()
+	n := len(renewer.guards)
+	renewer.mu.Unlock()
+	if n != 0 {
+		t.Errorf("guards: %d, want: 0 after release", n)
+	}
+	for _, key := range keys {
+		if n, _ := mem.Exists(key).Result(); n != 0 {
+			t.Errorf("key %s should be released", key)
+		}
+	}
+}
+
+func TestRenewerRemoveDuringExec(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	p := &memPipeliner{Client: mem, block: make(chan struct{})}
+	renewer, err := NewRenewer(p, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer renewer.Close()
+	guard, err := New(p, "lockguard:renewer:blocked", WithRenewer(renewer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- guard.Run(context.Background(), func(ctx context.Context) error {
+			// 等待一次续期卡在Exec中.
+			for atomic.LoadInt32(&p.execs) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			return nil
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("release should not wait for a renewal in flight")
+	}
+	close(p.block)
+	renewer.mu.Lock()
+	n := len(renewer.guards)
+	renewer.mu.Unlock()
+	if n != 0 {
+		t.Errorf("guards: %d, want: 0 after release", n)
+	}
+}
+
+func TestRenewerLockLost(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	p := &memPipeliner{Client: mem}
+	renewer, err := NewRenewer(p, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer renewer.Close()
+
+	o := &chanObserver{lost: make(chan error, 1)}
+	guard, err := New(p, "lockguard:renewer:lost", WithRenewer(renewer), WithObserver(o))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = guard.Run(context.Background(), func(ctx context.Context) error {
+		mem.Del("lockguard:renewer:lost")
+		select {
+		case err := <-o.lost:
+			if !errors.Is(err, errLockLost) {
+				t.Errorf("want: %v, got: %v", errLockLost, err)
+			}
+		case <-time.After(time.Second):
+			t.Error("lock lost not reported")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithRenewerValidation(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	p := &memPipeliner{Client: mem}
+	renewer, err := NewRenewer(p, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer renewer.Close()
+	if _, err := New(p, "lockguard:renewer", WithRenewer(renewer)); err == nil {
+		t.Error("renewer interval above expiration should fail")
+	}
+	if _, err := NewRenewer(p, 0); err == nil {
+		t.Error("zero interval should fail")
+	}
+}
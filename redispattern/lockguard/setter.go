@@ -1,5 +1,14 @@
 package lockguard
 
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/xiaojiaoyu100/lizard/backoff"
+)
+
 // Setter 配置lock.
 type Setter func(l *Lock) error
 
@@ -10,3 +19,328 @@ func WithRetryTimes(t int) Setter {
 		return nil
 	}
 }
+
+// WithBackOff configures the wait between retries, e.g. a *backoff.DecorrelatedJitter.
+// It is reset at the start of every Run and overrides WithBackoffBase and WithBackoffCap.
+// b is used by the guard as is, do not share it between guards running concurrently.
+func WithBackOff(b backoff.BackOff) Setter {
+	return func(l *Lock) error {
+		if b == nil {
+			return errors.New("backoff is nil")
+		}
+		l.backOff = b
+		return nil
+	}
+}
+
+// WithBackoffBase configures the base of the exponential full jitter backoff
+// between retries, 20ms by default. It must not exceed the cap.
+func WithBackoffBase(d time.Duration) Setter {
+	return func(l *Lock) error {
+		if d <= 0 {
+			return errors.New("backoff base is not positive")
+		}
+		l.backoffBase = d
+		return nil
+	}
+}
+
+// WithBackoffCap configures the cap of the exponential full jitter backoff
+// between retries, 100ms by default.
+func WithBackoffCap(d time.Duration) Setter {
+	return func(l *Lock) error {
+		if d <= 0 {
+			return errors.New("backoff cap is not positive")
+		}
+		l.backoffCap = d
+		return nil
+	}
+}
+
+// WithRenew configures renewal while the handler runs: the lock is renewed
+// every interval, shortened by a random fraction in [0, jitterFraction) of it
+// so that guards taken together do not renew in lockstep. interval must be
+// less than the expiration. By default the lock is renewed every third of
+// its expiration with a jitter fraction of 0.1.
+func WithRenew(interval time.Duration, jitterFraction float64) Setter {
+	return func(l *Lock) error {
+		if interval <= 0 {
+			return errors.New("renew interval is not positive")
+		}
+		if jitterFraction < 0 || jitterFraction >= 1 {
+			return errors.New("renew jitter fraction is not in [0, 1)")
+		}
+		l.renewInterval = interval
+		l.renewJitter = jitterFraction
+		return nil
+	}
+}
+
+// WithAutoRenew(false) disables renewal, the lock then simply expires after
+// its expiration if handler has not returned by then. Handler runs inline
+// on the calling goroutine, the fast path for short critical sections on hot
+// paths; it must watch ctx itself, Run cannot return before it does.
+func WithAutoRenew(enabled bool) Setter {
+	return func(l *Lock) error {
+		l.noRenew = !enabled
+		return nil
+	}
+}
+
+// WithOperationTimeout bounds every single redis operation by d on top of the
+// context of the caller, so that a wedged connection cannot hang a Run which
+// was given context.Background(). Renewal and release only use d: release
+// must still happen once the caller's context is done, without blocking
+// shutdown for long. Only the clients of go-redis support it, zero, the
+// default, disables it.
+func WithOperationTimeout(d time.Duration) Setter {
+	return func(l *Lock) error {
+		if d < 0 {
+			return errors.New("operation timeout is negative")
+		}
+		l.operationTimeout = d
+		return nil
+	}
+}
+
+// WithHandlerTimeout cancels the context of the handler once it has held the
+// lock for d, so that a buggy handler cannot keep the lock for long. Run then
+// returns an error satisfying IsHandlerTimeout and releases the lock without
+// waiting for the handler, unless it runs inline, see WithAutoRenew.
+func WithHandlerTimeout(d time.Duration) Setter {
+	return func(l *Lock) error {
+		if d <= 0 {
+			return errors.New("handler timeout is not positive")
+		}
+		l.handlerTimeout = d
+		return nil
+	}
+}
+
+// WithRenewRetries configures how many times a failed renewal is retried
+// before the lock is considered lost.
+func WithRenewRetries(n int) Setter {
+	return func(l *Lock) error {
+		if n < 0 {
+			return errors.New("renew retries is negative")
+		}
+		l.renewRetries = n
+		return nil
+	}
+}
+
+// WithRandReader configures the source of the random lock value, crypto/rand.Reader by default.
+// A deterministic reader makes lock values reproducible in tests. Guards
+// running concurrently read r concurrently, so a shared r must allow it.
+func WithRandReader(r io.Reader) Setter {
+	return func(l *Lock) error {
+		if r == nil {
+			return errors.New("rand reader is nil")
+		}
+		l.randReader = r
+		return nil
+	}
+}
+
+// WithValue makes the lock hold v instead of a random value, e.g. a
+// correlation id or an externally generated fencing token. The caller is
+// responsible for v being unique among contenders: two guards holding the
+// same value can release and extend each other's lock. A failed SETNX, e.g.
+// on a reconnect after failover, normally gets the next attempt a fresh value
+// so that it cannot be confused with whatever the failed one left behind; v
+// is reused as is instead.
+func WithValue(v string) Setter {
+	return func(l *Lock) error {
+		if v == "" {
+			return errors.New("value length is zero")
+		}
+		l.providedValue = v
+		return nil
+	}
+}
+
+// WithTraceIDFunc stores the trace id that fn extracts from the context of
+// Run in the owner metadata, so that Inspect tells which request holds the
+// lock. lockguard does not depend on a tracing library, with OpenTelemetry fn
+// would be:
+//
+//	func(ctx context.Context) string {
+//		return trace.SpanContextFromContext(ctx).TraceID().String()
+//	}
+//
+// It has no effect together with WithValue.
+func WithTraceIDFunc(fn func(ctx context.Context) string) Setter {
+	return func(l *Lock) error {
+		if fn == nil {
+			return errors.New("trace id func is nil")
+		}
+		l.traceIDFunc = fn
+		return nil
+	}
+}
+
+// WithInstanceID stores id, e.g. the pod or host name, in the owner metadata
+// of the lock and appends it to the log lines, so that Inspect can map a
+// stuck lock to the instance holding it. Connections are not the lock's to
+// name: to label them in CLIENT LIST, call CLIENT SETNAME in the OnConnect hook
+// of the go-redis options.
+func WithInstanceID(id string) Setter {
+	return func(l *Lock) error {
+		if id == "" {
+			return errors.New("instance id length is zero")
+		}
+		l.instanceID = id
+		return nil
+	}
+}
+
+// WithLogger configures the logger for warnings.
+func WithLogger(logger Logger) Setter {
+	return func(l *Lock) error {
+		l.logger = logger
+		return nil
+	}
+}
+
+// WithObserver configures the observer of lock events.
+func WithObserver(observer Observer) Setter {
+	return func(l *Lock) error {
+		l.observer = observer
+		return nil
+	}
+}
+
+// WithSlowAcquireThreshold logs a warning through the logger when acquiring
+// the lock takes longer than d, zero disables it.
+func WithSlowAcquireThreshold(d time.Duration) Setter {
+	return func(l *Lock) error {
+		if d < 0 {
+			return errors.New("slow acquire threshold is negative")
+		}
+		l.slowAcquireThreshold = d
+		return nil
+	}
+}
+
+// WithTag records the lock key under tag while the lock is held, so that
+// ForceUnlockByTag can release all locks of that tag at once.
+func WithTag(tag string) Setter {
+	return func(l *Lock) error {
+		if tag == "" {
+			return errors.New("tag length is zero")
+		}
+		l.tag = tag
+		return nil
+	}
+}
+
+// WithManager registers the lock with m while it is held.
+func WithManager(m *Manager) Setter {
+	return func(l *Lock) error {
+		if m == nil {
+			return errors.New("manager is nil")
+		}
+		l.manager = m
+		return nil
+	}
+}
+
+// WithFencingToken takes a fencing token on every acquisition: a number that
+// grows each time the lock is obtained, handed to the handler through its
+// context, see TokenFromContext. Storage that rejects writes carrying a token
+// lower than one it has seen stays safe even if a paused holder wakes up after
+// its lock expired. The counter is kept at its own key which never expires.
+func WithFencingToken() Setter {
+	return func(l *Lock) error {
+		l.fencing = true
+		return nil
+	}
+}
+
+// WithTTLCheck reads the remaining ttl before every n-th renewal and warns
+// through the logger, and the Observer if it implements LowTTLObserver, when
+// it is below threshold. Zero threshold means half of the expiration.
+// It costs one more round trip per checked renewal, so it is off by default.
+func WithTTLCheck(n int, threshold time.Duration) Setter {
+	return func(l *Lock) error {
+		if n < 1 {
+			return errors.New("ttl check frequency is less than 1")
+		}
+		if threshold < 0 {
+			return errors.New("ttl check threshold is negative")
+		}
+		l.ttlCheckEvery = n
+		l.ttlCheckThreshold = threshold
+		return nil
+	}
+}
+
+// WithEpochCheck increments an epoch counter kept next to the lock every time
+// the lock is obtained, and has renewal and TryExtend refuse with an error
+// satisfying IsEpochRegressed once the counter is below the epoch taken. If
+// redis fails over to a replica that was behind, the counter may regress
+// while the lock looks free there: renewal then reports the lock as lost
+// with that error rather than as a plain loss.
+//
+// It is a detection signal, not a fix. Nothing is checked between renewals,
+// so a handler may run under split brain for up to the renew interval; a
+// replica which received the increment but not the lock goes unnoticed as a
+// regression and is reported as a plain loss; and writes outside lockguard
+// stay unprotected, see WithFencingToken for that.
+func WithEpochCheck() Setter {
+	return func(l *Lock) error {
+		l.epochCheck = true
+		return nil
+	}
+}
+
+// WithMaxWaiters fails fast with an error satisfying IsTooManyWaiters instead
+// of retrying when n callers already retry for the lock, to shed load on a
+// pathologically contended key. Callers are counted atomically in a key next
+// to the lock expiring one expiration after the last of them joined, so the
+// count is approximate for waits longer than that or after crashes.
+func WithMaxWaiters(n int) Setter {
+	return func(l *Lock) error {
+		if n < 1 {
+			return errors.New("max waiters is less than 1")
+		}
+		l.maxWaiters = n
+		return nil
+	}
+}
+
+// WithRenewer has r renew the lock instead of a goroutine of its own, see Renewer.
+func WithRenewer(r *Renewer) Setter {
+	return func(l *Lock) error {
+		if r == nil {
+			return errors.New("renewer is nil")
+		}
+		l.renewer = r
+		return nil
+	}
+}
+
+// WithInitialJitter sleeps a random duration in [0, max) before the first
+// attempt of every Run, so that instances starting together do not all race
+// for the lock at once. A ctx done while sleeping ends Run without an attempt.
+func WithInitialJitter(max time.Duration) Setter {
+	return func(l *Lock) error {
+		if max < 0 {
+			return errors.New("initial jitter is negative")
+		}
+		l.initialJitter = max
+		return nil
+	}
+}
+
+// WithUnlockFailurePolicy configures what Run does when releasing the lock
+// fails, UnlockReturnError by default.
+func WithUnlockFailurePolicy(p UnlockFailurePolicy) Setter {
+	return func(l *Lock) error {
+		if p < UnlockReturnError || p > UnlockRetry {
+			return errors.New("unknown unlock failure policy")
+		}
+		l.unlockPolicy = p
+		return nil
+	}
+}
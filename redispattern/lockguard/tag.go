@@ -0,0 +1,93 @@
+package lockguard
+
+import (
+	"context"
+	"errors"
+)
+
+const tagKeyPrefix = "lockguard:tag:"
+
+func tagKey(tag string) string {
+	return tagKeyPrefix + tag
+}
+
+// addTag records the lock key in its tag set, the set lives as long as the
+// lock. A failure is logged, it only hides the lock from ForceUnlockByTag.
+func (guard *LockGuard) addTag(ctx context.Context) {
+	if guard.lock.tag == "" {
+		return
+	}
+	c, cancel := guard.client(ctx)
+	defer cancel()
+	r := c.(tagRediser)
+	k := tagKey(guard.lock.tag)
+	err := r.SAdd(k, guard.lock.Key).Err()
+	if err == nil {
+		err = r.Expire(k, guard.lock.expiration).Err()
+	}
+	if err != nil {
+		guard.logf("lockguard: add tag failed, key: %s, tag: %s, err: %v", guard.lock.Key, guard.lock.tag, err)
+	}
+}
+
+// renewTag and removeTag are not bound by the caller's ctx, like renewal and
+// release.
+func (guard *LockGuard) renewTag() {
+	if guard.lock.tag == "" {
+		return
+	}
+	r, cancel := guard.client(context.Background())
+	defer cancel()
+	if err := r.Expire(tagKey(guard.lock.tag), guard.lock.expiration).Err(); err != nil {
+		guard.logf("lockguard: renew tag failed, key: %s, tag: %s, err: %v", guard.lock.Key, guard.lock.tag, err)
+	}
+}
+
+func (guard *LockGuard) removeTag() {
+	if guard.lock.tag == "" {
+		return
+	}
+	r, cancel := guard.client(context.Background())
+	defer cancel()
+	if err := r.(tagRediser).SRem(tagKey(guard.lock.tag), guard.lock.Key).Err(); err != nil {
+		guard.logf("lockguard: remove tag failed, key: %s, tag: %s, err: %v", guard.lock.Key, guard.lock.tag, err)
+	}
+}
+
+// ForceUnlockByTag deletes every lock acquired with WithTag(tag) regardless of
+// its owner and returns how many locks were deleted. Keys that no longer
+// exist are dropped from the tag set. It is a recovery tool for operators,
+// the owners of the deleted locks are not notified.
+func ForceUnlockByTag(ctx context.Context, redis tagRediser, tag string) (int, error) {
+	if tag == "" {
+		return 0, errors.New("tag length is zero")
+	}
+	k := tagKey(tag)
+	var (
+		cursor  uint64
+		deleted int
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return deleted, err
+		}
+		keys, next, err := redis.SScan(k, cursor, "", 100).Result()
+		if err != nil {
+			return deleted, err
+		}
+		for _, key := range keys {
+			n, err := redis.Del(key).Result()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += int(n)
+			if err := redis.SRem(k, key).Err(); err != nil {
+				return deleted, err
+			}
+		}
+		if next == 0 {
+			return deleted, nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,73 @@
+package lockguard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+)
+
+func TestForceUnlockByTag(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+
+	// A stale member whose lock has already gone away.
+	mem.SAdd(tagKey("deploy"), "lockguard:gone")
+
+	guard, err := New(mem, "lockguard:tagged", WithTag("deploy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = guard.Run(context.Background(), func(ctx context.Context) error {
+		n, err := ForceUnlockByTag(ctx, mem, "deploy")
+		if err != nil {
+			return err
+		}
+		if n != 1 {
+			t.Errorf("deleted: %d, want: 1", n)
+		}
+		if ok, _ := mem.SetNX("lockguard:tagged", "other", 0).Result(); !ok {
+			t.Error("lock should be free after ForceUnlockByTag")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := mem.Del(tagKey("deploy")).Result(); n != 0 {
+		t.Error("tag set should be empty")
+	}
+}
+
+// noSAdd fails SADD, e.g. on a proxy refusing set commands.
+type noSAdd struct {
+	*memrediser.Client
+}
+
+func (r noSAdd) SAdd(key string, members ...interface{}) *redis.IntCmd {
+	return redis.NewIntResult(0, errors.New("ERR unknown command 'SADD'"))
+}
+
+func TestAddTagFailureIsLogged(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	var buf bytes.Buffer
+	guard, err := New(noSAdd{mem}, "lockguard:tagged", WithTag("deploy"), WithLogger(log.New(&buf, "", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = guard.Run(context.Background(), func(ctx context.Context) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("a failed tag should not fail Run: %v", err)
+	}
+	if !strings.Contains(buf.String(), "add tag failed") {
+		t.Errorf("log: %q, want the add tag failure", buf.String())
+	}
+}
@@ -0,0 +1,40 @@
+package lockguard
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v7"
+)
+
+func noCancel() {}
+
+// client returns the client for one redis operation bounded by ctx and the
+// operation timeout, the caller must call cancel once the operation is done.
+// go-redis v7 only honours a context bound through WithContext.
+func (guard *LockGuard) client(ctx context.Context) (r rediser, cancel context.CancelFunc) {
+	d := guard.lock.operationTimeout
+	if d == 0 {
+		return guard.lock.redis, noCancel
+	}
+	ctx, cancel = context.WithTimeout(ctx, d)
+	switch c := guard.lock.redis.(type) {
+	case *redis.Client:
+		return c.WithContext(ctx), cancel
+	case *redis.Ring:
+		return c.WithContext(ctx), cancel
+	case *redis.ClusterClient:
+		return c.WithContext(ctx), cancel
+	}
+	// New只允许上面三种客户端设置超时.
+	cancel()
+	return guard.lock.redis, noCancel
+}
+
+// supportsTimeout reports whether r can bound its operations by a context.
+func supportsTimeout(r rediser) bool {
+	switch r.(type) {
+	case *redis.Client, *redis.Ring, *redis.ClusterClient:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package lockguard
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+func TestWithOperationTimeout(t *testing.T) {
+	_, err := New(newStubRediser(true), "lockguard:timeout", WithOperationTimeout(time.Second))
+	if !errors.Is(err, errUnsupported) {
+		t.Errorf("custom client, want: %v, got: %v", errUnsupported, err)
+	}
+
+	c := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})
+	defer c.Close()
+	guard, err := New(c, "lockguard:timeout", WithOperationTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, cancel := guard.client(context.Background())
+	defer cancel()
+	bound, ok := r.(*redis.Client)
+	if !ok {
+		t.Fatalf("client: %T, want *redis.Client", r)
+	}
+	deadline, ok := bound.Context().Deadline()
+	if !ok || time.Until(deadline) > time.Second {
+		t.Errorf("deadline: %v, %t, want within 1s", deadline, ok)
+	}
+}
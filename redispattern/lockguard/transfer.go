@@ -0,0 +1,43 @@
+package lockguard
+
+import (
+	"context"
+	"errors"
+
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/script"
+	"github.com/xiaojiaoyu100/lizard/timekit"
+)
+
+const transferLuaScript = script.LockGuardTransfer
+
+// Transfer atomically replaces the value of the held lock by newValue and
+// refreshes its ttl, so that no contender can obtain the lock in between.
+// It returns false if the lock is no longer ours. On success the guard goes
+// on renewing and eventually releases the lock under newValue, the party
+// handed newValue owns it cooperatively with the guard from then on.
+func (guard *LockGuard) Transfer(ctx context.Context, newValue string) (bool, error) {
+	if newValue == "" {
+		return false, errors.New("value length is zero")
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if !guard.lock.locked {
+		return false, nil
+	}
+	r, cancel := guard.client(ctx)
+	defer cancel()
+	guard.valueMu.Lock()
+	defer guard.valueMu.Unlock()
+	keys := []string{guard.lock.Key}
+	ttl := timekit.DurationToMillis(guard.lock.expiration)
+	n, err := r.Eval(transferLuaScript, keys, guard.lock.Value, newValue, ttl).Int64()
+	if err != nil {
+		return false, err
+	}
+	if n != 1 {
+		return false, nil
+	}
+	guard.lock.Value = newValue
+	return true, nil
+}
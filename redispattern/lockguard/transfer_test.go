@@ -0,0 +1,65 @@
+package lockguard
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+)
+
+func TestTransfer(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	guard, err := New(mem, "lockguard:transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = guard.Run(context.Background(), func(ctx context.Context) error {
+		if ok, err := guard.Transfer(ctx, "worker-1"); err != nil || !ok {
+			t.Errorf("transfer: %t, %v, want: true, nil", ok, err)
+		}
+		if v, _ := mem.Get("lockguard:transfer").Result(); v != "worker-1" {
+			t.Errorf("value: %q, want: worker-1", v)
+		}
+		if ok, err := guard.OwnsLock(ctx); err != nil || !ok {
+			t.Errorf("OwnsLock after transfer: %t, %v, want: true, nil", ok, err)
+		}
+		mem.Del("lockguard:transfer")
+		if ok, err := guard.Transfer(ctx, "worker-2"); err != nil || ok {
+			t.Errorf("transfer of a lost lock: %t, %v, want: false, nil", ok, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransferReleaseAll(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	m := NewManager()
+	guard, err := New(mem, "lockguard:transfer:manager", WithManager(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = guard.Run(context.Background(), func(ctx context.Context) error {
+		if ok, err := guard.Transfer(ctx, "worker-1"); err != nil || !ok {
+			t.Fatalf("transfer: %t, %v, want: true, nil", ok, err)
+		}
+		// ReleaseAll须按转移后的值释放.
+		if err := m.ReleaseAll(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := mem.Exists("lockguard:transfer:manager").Result(); n != 0 {
+			t.Error("lock left behind by ReleaseAll after Transfer")
+		}
+		if n := m.Len(); n != 0 {
+			t.Errorf("held: %d, want: 0", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,62 @@
+package lockguard
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/script"
+	"github.com/xiaojiaoyu100/lizard/timekit"
+)
+
+const acquireOrGetLuaScript = script.LockGuardAcquireOrGet
+
+// TryLockOrOwner tries to obtain the lock once and, if it is held by someone
+// else, returns the value of the holder from the same round trip. The owner
+// metadata at its head can be decoded with ParseOwner. The owner is empty if
+// the lock was not obtained but nobody holds it any more.
+//
+// Unlike Run the lock is neither renewed nor released: it expires after the
+// expiration unless extended with TryExtend or released with Unlock. Fencing
+// tokens and epochs are only taken by Run.
+func (guard *LockGuard) TryLockOrOwner(ctx context.Context) (bool, string, error) {
+	if err := ctx.Err(); err != nil {
+		return false, "", err
+	}
+	guard.reset()
+	if err := guard.newValue(ctx); err != nil {
+		return false, "", err
+	}
+	r, cancel := guard.client(ctx)
+	defer cancel()
+	keys := []string{guard.lock.Key}
+	ttl := timekit.DurationToMillis(guard.lock.expiration)
+	v, err := r.Eval(acquireOrGetLuaScript, keys, guard.lock.Value, ttl).Result()
+	if err == redis.Nil {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	if owner, ok := v.(string); ok {
+		return false, owner, nil
+	}
+	guard.lock.locked = true
+	guard.renewedAt = time.Now()
+	guard.addTag(ctx)
+	guard.register()
+	return true, "", nil
+}
+
+// Unlock releases the lock obtained by TryLockOrOwner, it is a no-op if the
+// lock is not held. A failed release returns an *UnlockError and may be retried.
+func (guard *LockGuard) Unlock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := guard.unLock(); err != nil {
+		return err
+	}
+	guard.lock.locked = false
+	return nil
+}
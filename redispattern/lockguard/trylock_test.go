@@ -0,0 +1,48 @@
+package lockguard
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+)
+
+func TestTryLockOrOwner(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	ctx := context.Background()
+	holder, err := New(mem, "lockguard:trylock", WithInstanceID("holder"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := New(mem, "lockguard:trylock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired, owner, err := holder.TryLockOrOwner(ctx)
+	if err != nil || !acquired || owner != "" {
+		t.Fatalf("acquired: %t, owner: %q, err: %v, want the lock", acquired, owner, err)
+	}
+	acquired, owner, err = other.TryLockOrOwner(ctx)
+	if err != nil || acquired {
+		t.Fatalf("acquired: %t, err: %v, want the lock held", acquired, err)
+	}
+	if o := ParseOwner(owner); o == nil || o.InstanceID != "holder" {
+		t.Errorf("owner: %q, want the holder metadata", owner)
+	}
+	if err := other.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := mem.Exists("lockguard:trylock").Result(); n != 1 {
+		t.Error("unlock should not release a lock held by someone else")
+	}
+
+	if err := holder.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	acquired, _, err = other.TryLockOrOwner(ctx)
+	if err != nil || !acquired {
+		t.Errorf("acquired: %t, err: %v, want the released lock", acquired, err)
+	}
+}
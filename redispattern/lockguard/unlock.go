@@ -0,0 +1,48 @@
+package lockguard
+
+import (
+	"time"
+
+	"github.com/xiaojiaoyu100/lizard/backoff"
+)
+
+// unlockRetries is the number of retries of a failed release with UnlockRetry.
+const unlockRetries = 3
+
+// UnlockFailurePolicy decides what Run does when releasing the lock fails
+// after handler returned. The lock then lingers until it expires.
+type UnlockFailurePolicy int
+
+const (
+	// UnlockReturnError returns the *UnlockError from Run, the default.
+	UnlockReturnError UnlockFailurePolicy = iota
+	// UnlockLogOnly logs the failure to the logger and returns nil.
+	UnlockLogOnly
+	// UnlockRetry retries the release a few times with a tight backoff and
+	// returns the *UnlockError if it still fails.
+	UnlockRetry
+)
+
+// release releases the lock at the end of a Run following the unlock policy.
+func (guard *LockGuard) release() error {
+	err := guard.unLock()
+	if err == nil {
+		return nil
+	}
+	switch guard.lock.unlockPolicy {
+	case UnlockLogOnly:
+		guard.logf("lockguard: unlock failed, key: %s, err: %v", guard.lock.Key, err)
+		return nil
+	case UnlockRetry:
+		b := backoff.NewStrategyBackOff(backoff.ExponentialBackoffFullJitterStrategy{
+			ExponentialBackoff: backoff.ExponentialBackoff{
+				Base: 10 * time.Millisecond,
+				Cap:  100 * time.Millisecond,
+			}})
+		for i := 0; i < unlockRetries && err != nil; i++ {
+			time.Sleep(b.NextBackOff())
+			err = guard.unLock()
+		}
+	}
+	return err
+}
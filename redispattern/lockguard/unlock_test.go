@@ -0,0 +1,130 @@
+package lockguard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+)
+
+// unlockRediser fails the first failures releases.
+type unlockRediser struct {
+	*memrediser.Client
+	failures int
+	releases int
+}
+
+func (u *unlockRediser) Eval(script string, keys []string, args ...interface{}) *redis.Cmd {
+	if script == delLuaScript {
+		u.releases++
+		if u.failures > 0 {
+			u.failures--
+			return redis.NewCmdResult(nil, errors.New("i/o timeout"))
+		}
+	}
+	return u.Client.Eval(script, keys, args...)
+}
+
+func TestWithUnlockFailurePolicy(t *testing.T) {
+	tests := [...]struct {
+		Policy       UnlockFailurePolicy
+		Failures     int
+		WantErr      bool
+		WantLogged   bool
+		WantReleases int
+		WantHeld     bool
+	}{
+		0: {
+			Policy:       UnlockReturnError,
+			Failures:     1,
+			WantErr:      true,
+			WantReleases: 1,
+			WantHeld:     true,
+		},
+		1: {
+			Policy:       UnlockLogOnly,
+			Failures:     1,
+			WantLogged:   true,
+			WantReleases: 1,
+			WantHeld:     true,
+		},
+		2: {
+			Policy:       UnlockRetry,
+			Failures:     2,
+			WantReleases: 3,
+		},
+		3: {
+			Policy:       UnlockRetry,
+			Failures:     unlockRetries + 1,
+			WantErr:      true,
+			WantReleases: unlockRetries + 1,
+			WantHeld:     true,
+		},
+	}
+	for i, test := range tests {
+		mem := memrediser.New()
+		r := &unlockRediser{Client: mem, failures: test.Failures}
+		var buf bytes.Buffer
+		guard, err := New(r, "lockguard:unlock", WithUnlockFailurePolicy(test.Policy), WithLogger(log.New(&buf, "", 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = guard.Run(context.Background(), func(ctx context.Context) error { return nil })
+		var u *UnlockError
+		if gotErr := errors.As(err, &u); gotErr != test.WantErr {
+			t.Errorf("case: %d, unlock error: %t, want: %t, err: %v", i, gotErr, test.WantErr, err)
+		}
+		if logged := strings.Contains(buf.String(), "unlock failed"); logged != test.WantLogged {
+			t.Errorf("case: %d, logged: %t, want: %t", i, logged, test.WantLogged)
+		}
+		if r.releases != test.WantReleases {
+			t.Errorf("case: %d, releases: %d, want: %d", i, r.releases, test.WantReleases)
+		}
+		if n, _ := mem.Exists("lockguard:unlock").Result(); (n == 1) != test.WantHeld {
+			t.Errorf("case: %d, held: %t, want: %t", i, n == 1, test.WantHeld)
+		}
+		mem.Close()
+	}
+	if _, err := New(newStubRediser(true), "lockguard:unlock", WithUnlockFailurePolicy(UnlockRetry+1)); err == nil {
+		t.Error("an unknown policy should fail")
+	}
+}
+
+func TestHandlerAndUnlockFailure(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	r := &unlockRediser{Client: mem, failures: 1}
+	m := NewManager()
+	guard, err := New(r, "lockguard:unlock:both", WithManager(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	boom := errors.New("boom")
+	err = guard.Run(context.Background(), func(ctx context.Context) error { return boom })
+	if !errors.Is(err, boom) {
+		t.Fatalf("want the handler error, got: %v", err)
+	}
+	var h *HandlerError
+	var u *UnlockError
+	if !errors.As(err, &h) || !errors.As(h.Unlock, &u) || u.Key != "lockguard:unlock:both" {
+		t.Fatalf("want the unlock error in the handler error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "i/o timeout") {
+		t.Errorf("message: %q, want the unlock failure in it", err.Error())
+	}
+	// 释放失败的锁仍由Manager跟踪.
+	if n := m.Len(); n != 1 {
+		t.Fatalf("held after a failed unlock: %d, want: 1", n)
+	}
+	if err := m.ReleaseAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := mem.Exists("lockguard:unlock:both").Result(); n != 0 {
+		t.Error("lock left behind by ReleaseAll")
+	}
+}
@@ -0,0 +1,44 @@
+package lockguard
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/script"
+	"github.com/xiaojiaoyu100/lizard/timekit"
+)
+
+const (
+	waitersKeyPrefix = "lockguard:waiters:"
+
+	joinWaitLuaScript  = script.LockGuardJoinWait
+	leaveWaitLuaScript = script.LockGuardLeaveWait
+)
+
+func waitersKey(key string) string {
+	return waitersKeyPrefix + key
+}
+
+// joinWait counts the guard among the waiters of the lock, it fails with an
+// error satisfying IsTooManyWaiters if maxWaiters wait already.
+func (guard *LockGuard) joinWait(ctx context.Context) error {
+	r, cancel := guard.client(ctx)
+	defer cancel()
+	keys := []string{waitersKey(guard.lock.Key)}
+	ttl := timekit.DurationToMillis(guard.lock.expiration)
+	n, err := r.Eval(joinWaitLuaScript, keys, guard.lock.maxWaiters, ttl).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("key: %s, max waiters: %d, err: %w", guard.lock.Key, guard.lock.maxWaiters, errTooManyWaiters)
+	}
+	return nil
+}
+
+func (guard *LockGuard) leaveWait() {
+	// 与释放锁一样不受调用者ctx影响，ctx结束后仍需离开.
+	r, cancel := guard.client(context.Background())
+	defer cancel()
+	r.Eval(leaveWaitLuaScript, []string{waitersKey(guard.lock.Key)})
+}
@@ -0,0 +1,50 @@
+package lockguard
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+)
+
+func TestWithMaxWaiters(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	mem.SetNX("lockguard:waiters", "holder", time.Minute)
+
+	waiting := make(chan struct{})
+	done := make(chan error, 1)
+	first, err := New(mem, "lockguard:waiters", WithMaxWaiters(1), WithBackOff(&recordBackOff{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, err := first.TryRunN(ctx, 1000000, func(ctx context.Context) error { return nil })
+		done <- err
+	}()
+	go func() {
+		for {
+			if v, _ := mem.Get(waitersKey("lockguard:waiters")).Result(); v == "1" {
+				close(waiting)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	<-waiting
+
+	second, err := New(mem, "lockguard:waiters", WithRetryTimes(2), WithMaxWaiters(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Run(context.Background(), nil); !IsTooManyWaiters(err) {
+		t.Errorf("want too many waiters, got: %v", err)
+	}
+	cancel()
+	<-done
+	if n, _ := mem.Exists(waitersKey("lockguard:waiters")).Result(); n != 0 {
+		t.Error("waiter count should be gone once every waiter left")
+	}
+}
@@ -0,0 +1,53 @@
+package once
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error error
+type Error string
+
+const (
+	errExecutorFailed = Error("executor failed")
+	errWaitTimeout    = Error("wait for executor timed out")
+)
+
+// Error reports an error.
+func (e Error) Error() string {
+	return string(e)
+}
+
+// WaitTimeoutError reports that ctx ended while waiting for the executor of
+// another caller, it unwraps to the context error and satisfies IsWaitTimeout.
+type WaitTimeoutError struct {
+	Key string
+	Err error
+}
+
+// Error reports an error.
+func (e *WaitTimeoutError) Error() string {
+	return fmt.Sprintf("key: %s, err: %v: %v", e.Key, errWaitTimeout, e.Err)
+}
+
+// Unwrap returns the error of the context.
+func (e *WaitTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports target to be the wait timeout, see IsWaitTimeout.
+func (e *WaitTimeoutError) Is(target error) bool {
+	return target == errWaitTimeout
+}
+
+// IsExecutorFailed reports that the elected executor of another caller failed,
+// the stored failure expires after the error TTL so that a later call can retry.
+func IsExecutorFailed(err error) bool {
+	return errors.Is(err, errExecutorFailed)
+}
+
+// IsWaitTimeout reports that the caller's context ended while waiting for the
+// executor of another caller to complete, e.g. because the executor hangs.
+func IsWaitTimeout(err error) bool {
+	return errors.Is(err, errWaitTimeout)
+}
@@ -0,0 +1,304 @@
+// Package once runs a function once per key across instances and shares its
+// result with the duplicates, the idempotency helper of redispattern.
+package once
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/backoff"
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/script"
+	"github.com/xiaojiaoyu100/lizard/timekit"
+)
+
+// 存储在key上的值的前缀.
+const (
+	statePending = "p"
+	stateDone    = "d"
+	stateFailed  = "e"
+	stateGzipped = "z" // done, gzipped
+)
+
+type option struct {
+	lease     time.Duration
+	resultTTL time.Duration
+	errorTTL  time.Duration
+	wait      backoff.Strategy
+	maxSize   int
+	gzip      bool
+}
+
+// Setter configures option.
+type Setter func(o *option) error
+
+// WithLease configures how long an executor which stopped renewing, e.g.
+// because its process died, blocks the others before one takes over. The
+// lease is renewed every third of it while fn runs.
+func WithLease(d time.Duration) Setter {
+	return func(o *option) error {
+		if d < time.Millisecond {
+			return errors.New("lease is less than 1ms")
+		}
+		o.lease = d
+		return nil
+	}
+}
+
+// WithResultTTL configures how long the result is kept, zero keeps it forever.
+func WithResultTTL(d time.Duration) Setter {
+	return func(o *option) error {
+		if d < 0 {
+			return errors.New("result ttl is negative")
+		}
+		o.resultTTL = d
+		return nil
+	}
+}
+
+// WithErrorTTL configures how long a failure is reported to waiters
+// before the next call is elected to retry.
+func WithErrorTTL(d time.Duration) Setter {
+	return func(o *option) error {
+		if d < time.Millisecond {
+			return errors.New("error ttl is less than 1ms")
+		}
+		o.errorTTL = d
+		return nil
+	}
+}
+
+// WithWaitStrategy configures the delays between the polls of waiters, it
+// should be jittered so that the waiters of a popular key spread their polls.
+func WithWaitStrategy(strategy backoff.Strategy) Setter {
+	return func(o *option) error {
+		if strategy == nil {
+			return errors.New("wait strategy is nil")
+		}
+		o.wait = strategy
+		return nil
+	}
+}
+
+// WithMaxResultSize refuses to store a result taking more than n bytes in
+// redis, after compression if WithGzip is used, to protect redis memory from
+// e.g. full HTTP responses. Such a result is only returned to its executor,
+// see DoCached, the other callers execute fn themselves.
+func WithMaxResultSize(n int) Setter {
+	return func(o *option) error {
+		if n < 1 {
+			return errors.New("max result size is less than 1")
+		}
+		o.maxSize = n
+		return nil
+	}
+}
+
+// WithGzip gzips stored results, they are decompressed transparently on read.
+func WithGzip() Setter {
+	return func(o *option) error {
+		o.gzip = true
+		return nil
+	}
+}
+
+// Once 多个实例中只有一个执行函数，其余等待并共享其结果.
+type Once struct {
+	redis  rediser
+	option option
+}
+
+// New 生成Once.
+func New(redis rediser, setters ...Setter) (*Once, error) {
+	o := option{
+		lease:    30 * time.Second,
+		errorTTL: 10 * time.Second,
+		wait: backoff.ExponentialBackoffFullJitterStrategy{
+			ExponentialBackoff: backoff.ExponentialBackoff{
+				Base: 20 * time.Millisecond,
+				Cap:  time.Second,
+			}},
+	}
+	for _, setter := range setters {
+		if err := setter(&o); err != nil {
+			return nil, err
+		}
+	}
+	return &Once{
+		redis:  redis,
+		option: o,
+	}, nil
+}
+
+// Do runs fn on exactly one caller per key and returns its result to every
+// caller. The elected executor holds a lease renewed while fn runs and
+// stores the result only if it still holds it. Waiters poll until it is
+// available with the jittered delays of the wait strategy, so that many
+// duplicates do not stampede redis. ctx bounds the wait, when it ends first
+// Do returns a *WaitTimeoutError wrapping ctx.Err(). If fn fails the failure is
+// stored for the error TTL so waiters return an error (see IsExecutorFailed)
+// instead of waiting forever. If the executor dies, its lease expires and a
+// waiter is elected instead.
+func (o *Once) Do(ctx context.Context, key string, fn func() ([]byte, error)) ([]byte, error) {
+	result, _, err := o.DoCached(ctx, key, fn)
+	return result, err
+}
+
+// DoCached is Do also reporting whether the result is stored to be replayed
+// to other callers. It is false for a result over the max result size, which
+// is returned to its executor only.
+func (o *Once) DoCached(ctx context.Context, key string, fn func() ([]byte, error)) ([]byte, bool, error) {
+	if key == "" {
+		return nil, false, errors.New("key length is zero")
+	}
+	// 每次Do独立的回退状态，Once可被并发使用.
+	b := backoff.NewStrategyBackOff(o.option.wait)
+	for {
+		lease, err := newLease()
+		if err != nil {
+			return nil, false, err
+		}
+		elected, err := o.redis.SetNX(key, lease, o.option.lease).Result()
+		if err != nil {
+			return nil, false, err
+		}
+		if elected {
+			return o.execute(key, lease, fn)
+		}
+
+		for {
+			value, err := o.redis.Get(key).Result()
+			if err == redis.Nil {
+				// 执行者的lease过期或失败记录过期，重新选举.
+				break
+			}
+			if err != nil {
+				return nil, false, err
+			}
+			switch {
+			case strings.HasPrefix(value, stateDone):
+				return []byte(value[len(stateDone):]), true, nil
+			case strings.HasPrefix(value, stateGzipped):
+				result, err := gunzip(value[len(stateGzipped):])
+				return result, err == nil, err
+			case strings.HasPrefix(value, stateFailed):
+				return nil, false, fmt.Errorf("key: %s, err: %s: %w", key, value[len(stateFailed):], errExecutorFailed)
+			}
+			t := time.NewTimer(b.NextBackOff())
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return nil, false, &WaitTimeoutError{Key: key, Err: ctx.Err()}
+			}
+		}
+	}
+}
+
+// newLease returns the pending marker of an executor, unique per election.
+func newLease() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return statePending + hex.EncodeToString(b), nil
+}
+
+func (o *Once) execute(key, lease string, fn func() ([]byte, error)) ([]byte, bool, error) {
+	result, err := o.run(key, lease, fn)
+	if err != nil {
+		if _, serr := o.store(key, lease, stateFailed+err.Error(), o.option.errorTTL); serr != nil {
+			return nil, false, fmt.Errorf("%v, store failure: %w", err, serr)
+		}
+		return nil, false, err
+	}
+	state, value := stateDone, string(result)
+	if o.option.gzip {
+		state = stateGzipped
+		if value, err = gzipped(result); err != nil {
+			return nil, false, err
+		}
+	}
+	if o.option.maxSize > 0 && len(value) > o.option.maxSize {
+		// 结果过大不缓存，释放选举让其他调用者自行执行.
+		if err := o.redis.Eval(script.OnceRelease, []string{key}, lease).Err(); err != nil {
+			return nil, false, err
+		}
+		return result, false, nil
+	}
+	// 失去lease时其他调用者已被选举，结果仍返回给本调用者但不缓存.
+	stored, err := o.store(key, lease, state+value, o.option.resultTTL)
+	if err != nil {
+		return nil, false, err
+	}
+	return result, stored, nil
+}
+
+// run runs fn while renewing the lease.
+func (o *Once) run(key, lease string, fn func() ([]byte, error)) ([]byte, error) {
+	stop := make(chan struct{})
+	renewed := make(chan struct{})
+	go o.renew(key, lease, stop, renewed)
+	defer func() {
+		close(stop)
+		<-renewed
+	}()
+	return fn()
+}
+
+// renew renews the lease until stop is closed or the lease is lost.
+func (o *Once) renew(key, lease string, stop <-chan struct{}, renewed chan<- struct{}) {
+	defer close(renewed)
+	t := time.NewTicker(o.option.lease / 3)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			// 出错时下次再试，lease仍剩余三分之二.
+			n, err := o.redis.Eval(script.OnceRenew, []string{key}, lease, timekit.DurationToMillis(o.option.lease)).Int64()
+			if err == nil && n == 0 {
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// store sets key to value if the lease is still held and reports whether it was.
+func (o *Once) store(key, lease, value string, ttl time.Duration) (bool, error) {
+	n, err := o.redis.Eval(script.OnceStore, []string{key}, lease, value, timekit.DurationToMillis(ttl)).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func gzipped(result []byte) (string, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(result); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func gunzip(s string) ([]byte, error) {
+	r, err := gzip.NewReader(strings.NewReader(s))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,214 @@
+package once
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xiaojiaoyu100/lizard/redispattern/fakerediser"
+)
+
+func TestWithMaxResultSize(t *testing.T) {
+	tests := [...]struct {
+		Size       int
+		WantCached bool
+	}{
+		0: {
+			8,
+			true,
+		},
+		1: {
+			9,
+			false,
+		},
+	}
+	for _, test := range tests {
+		r := fakerediser.New()
+		defer r.Close()
+		o, err := New(r, WithMaxResultSize(8))
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload := bytes.Repeat([]byte{'a'}, test.Size)
+		result, cached, err := o.DoCached(context.Background(), "once:size", func() ([]byte, error) {
+			return payload, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(result, payload) {
+			t.Errorf("size: %d, the executor should get its result back", test.Size)
+		}
+		if cached != test.WantCached {
+			t.Errorf("size: %d, cached: %t, want: %t", test.Size, cached, test.WantCached)
+		}
+		if n, _ := r.Exists("once:size").Result(); (n == 1) != test.WantCached {
+			t.Errorf("size: %d, stored: %t, want: %t", test.Size, n == 1, test.WantCached)
+		}
+	}
+}
+
+func TestWithGzip(t *testing.T) {
+	r := fakerediser.New()
+	defer r.Close()
+	o, err := New(r, WithGzip())
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte(strings.Repeat("HTTP/1.1 200 OK\r\n", 64))
+	fn := func() ([]byte, error) { return payload, nil }
+	if _, err := o.Do(context.Background(), "once:gzip", fn); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := r.Get("once:gzip").Result(); !strings.HasPrefix(stored, stateGzipped) || len(stored) >= len(payload) {
+		t.Fatalf("stored %d bytes, want a gzipped value smaller than %d", len(stored), len(payload))
+	}
+	result, cached, err := o.DoCached(context.Background(), "once:gzip", func() ([]byte, error) {
+		t.Error("fn should not run again")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cached || !bytes.Equal(result, payload) {
+		t.Errorf("cached: %t, want the payload replayed", cached)
+	}
+}
+
+func TestDoSharesResult(t *testing.T) {
+	r := fakerediser.New()
+	defer r.Close()
+	o, err := New(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		wg    sync.WaitGroup
+		calls int32
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := o.Do(context.Background(), "once:share", func() ([]byte, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(20 * time.Millisecond)
+				return []byte("result"), nil
+			})
+			if err != nil || string(result) != "result" {
+				t.Errorf("result: %q, err: %v", result, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("calls: %d, want: 1", calls)
+	}
+}
+
+func TestDoRenewsLease(t *testing.T) {
+	r := fakerediser.New()
+	defer r.Close()
+	o, err := New(r, WithLease(30*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls int32
+	fn := func() ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		return []byte("slow"), nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := o.Do(context.Background(), "once:slow", fn); err != nil {
+				t.Error(err)
+			}
+		}()
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("calls: %d, want: 1 for fn outliving its lease", calls)
+	}
+}
+
+func TestDoCachesError(t *testing.T) {
+	r := fakerediser.New()
+	defer r.Close()
+	o, err := New(r, WithErrorTTL(30*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	boom := errors.New("boom")
+	if _, err := o.Do(context.Background(), "once:error", func() ([]byte, error) { return nil, boom }); err != boom {
+		t.Fatalf("executor want: %v, got: %v", boom, err)
+	}
+	_, err = o.Do(context.Background(), "once:error", func() ([]byte, error) {
+		t.Error("fn should not run while the failure is stored")
+		return nil, nil
+	})
+	if !IsExecutorFailed(err) || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("want an executor failure, got: %v", err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	result, err := o.Do(context.Background(), "once:error", func() ([]byte, error) { return []byte("ok"), nil })
+	if err != nil || string(result) != "ok" {
+		t.Errorf("a retry after the error ttl: %q, err: %v", result, err)
+	}
+}
+
+func TestDoLostLease(t *testing.T) {
+	r := fakerediser.New()
+	defer r.Close()
+	o, err := New(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, cached, err := o.DoCached(context.Background(), "once:lost", func() ([]byte, error) {
+		// 模拟lease过期后另一执行者被选举.
+		r.Set("once:lost", statePending+"other", 0)
+		return []byte("mine"), nil
+	})
+	if err != nil || string(result) != "mine" || cached {
+		t.Errorf("result: %q, cached: %t, err: %v, want the result uncached", result, cached, err)
+	}
+	if v, _ := r.Get("once:lost").Result(); v != statePending+"other" {
+		t.Errorf("stored: %q, the other executor's lease should be kept", v)
+	}
+}
+
+func TestDoWaitTimeout(t *testing.T) {
+	r := fakerediser.New()
+	defer r.Close()
+	o, err := New(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 另一执行者持有lease且一直未完成.
+	r.Set("once:timeout", statePending+"other", time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	_, err = o.Do(ctx, "once:timeout", func() ([]byte, error) {
+		t.Error("fn should not run while another executor holds the lease")
+		return nil, nil
+	})
+	if !IsWaitTimeout(err) {
+		t.Errorf("want a wait timeout, got: %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want %v wrapped, got: %v", context.DeadlineExceeded, err)
+	}
+	var e *WaitTimeoutError
+	if !errors.As(err, &e) || e.Key != "once:timeout" {
+		t.Errorf("want a *WaitTimeoutError of once:timeout, got: %v", err)
+	}
+}
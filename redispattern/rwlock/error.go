@@ -0,0 +1,26 @@
+package rwlock
+
+import "errors"
+
+// Error error
+type Error string
+
+const (
+	errLockNotObtained = Error("lock not obtained")
+	errNotLocked       = Error("not locked")
+)
+
+// Error reports an error.
+func (e Error) Error() string {
+	return string(e)
+}
+
+// IsLockNotObtained reports a lock which is not obtained.
+func IsLockNotObtained(err error) bool {
+	return errors.Is(err, errLockNotObtained)
+}
+
+// IsNotLocked reports an unlock of a lock the guard does not hold in that mode.
+func IsNotLocked(err error) bool {
+	return errors.Is(err, errNotLocked)
+}
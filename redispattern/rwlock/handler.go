@@ -0,0 +1,6 @@
+package rwlock
+
+import "context"
+
+// Handler signature.
+type Handler func(ctx context.Context) error
@@ -0,0 +1,244 @@
+// Package rwlock provides a distributed readers-writer lock.
+package rwlock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xiaojiaoyu100/lizard/backoff"
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/runner"
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/script"
+	"github.com/xiaojiaoyu100/lizard/timekit"
+)
+
+type mode int
+
+const (
+	modeNone mode = iota
+	modeRead
+	modeWrite
+)
+
+// RWLockGuard is one holder of a distributed readers-writer lock: any number
+// of readers or a single writer. Holders are members of a sorted set scored
+// by their last renewal, holders which stop renewing are dropped once
+// expiration passes. A steady stream of readers can starve writers.
+type RWLockGuard struct {
+	redis  rediser
+	key    string
+	id     string
+	option option
+
+	mu        sync.Mutex // guards mode against the renewal goroutine of RRun and WRun
+	mode      mode
+	renewedAt time.Time // last time the hold was known to be ours
+}
+
+// New 生成一个读写锁的持有者，同一个RWLockGuard实例不可用于并发环境中.
+func New(redis rediser, key string, setters ...Setter) (*RWLockGuard, error) {
+	if key == "" {
+		return nil, errors.New("key length is zero")
+	}
+	o := option{
+		retryTimes: 1,
+		expiration: 30 * time.Second,
+	}
+	for _, setter := range setters {
+		if err := setter(&o); err != nil {
+			return nil, err
+		}
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &RWLockGuard{
+		redis:  redis,
+		key:    key,
+		id:     hex.EncodeToString(b),
+		option: o,
+	}, nil
+}
+
+// RLock obtains the lock for reading, it fails with an error satisfying
+// IsLockNotObtained if a writer holds it through every retry.
+func (guard *RWLockGuard) RLock(ctx context.Context) error {
+	return guard.lock(ctx, script.RWLockRead, modeRead)
+}
+
+// Lock obtains the lock for writing, it fails with an error satisfying
+// IsLockNotObtained if anybody else holds it through every retry.
+func (guard *RWLockGuard) Lock(ctx context.Context) error {
+	return guard.lock(ctx, script.RWLockWrite, modeWrite)
+}
+
+// RUnlock releases the read hold.
+func (guard *RWLockGuard) RUnlock(ctx context.Context) error {
+	return guard.unlock(ctx, modeRead)
+}
+
+// Unlock releases the write hold.
+func (guard *RWLockGuard) Unlock(ctx context.Context) error {
+	return guard.unlock(ctx, modeWrite)
+}
+
+// Upgrade atomically turns the read hold into the write hold if the guard is
+// the only reader, so that no writer can slip in between. Otherwise it
+// returns false and the guard keeps reading.
+//
+// Upgrade makes a single attempt on purpose: two readers waiting for each
+// other to leave so that they can upgrade would deadlock. On false, release
+// with RUnlock, then Lock and re-check whatever was read, since another
+// writer may have run in between.
+func (guard *RWLockGuard) Upgrade(ctx context.Context) (bool, error) {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+	if guard.mode != modeRead {
+		return false, fmt.Errorf("key: %s, err: upgrade without read hold: %w", guard.key, errNotLocked)
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	ok, err := guard.eval(script.RWLockUpgrade, guard.id)
+	if err != nil || !ok {
+		return false, err
+	}
+	guard.mode = modeWrite
+	guard.renewedAt = now
+	return true, nil
+}
+
+// RRun obtains the lock for reading, runs handler while renewing it and
+// releases it afterwards, even if handler panics. handler may Upgrade, the
+// write hold is then renewed and released instead.
+func (guard *RWLockGuard) RRun(ctx context.Context, handler Handler) error {
+	if err := guard.RLock(ctx); err != nil {
+		return err
+	}
+	return guard.run(ctx, handler)
+}
+
+// WRun obtains the lock for writing, runs handler while renewing it and
+// releases it afterwards, even if handler panics.
+func (guard *RWLockGuard) WRun(ctx context.Context, handler Handler) error {
+	if err := guard.Lock(ctx); err != nil {
+		return err
+	}
+	return guard.run(ctx, handler)
+}
+
+func (guard *RWLockGuard) run(ctx context.Context, handler Handler) error {
+	return runner.Run(ctx, runner.Renewal{
+		Interval: guard.option.expiration / 3,
+		Jitter:   0.1,
+		Renew:    guard.renew,
+	}, guard.release, handler)
+}
+
+// renew reports whether the hold may still be ours. Errors are treated as
+// transient until expiration has passed since the last renewal, by then the
+// other holders prune the hold anyway.
+func (guard *RWLockGuard) renew() bool {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+	if guard.mode == modeNone {
+		return false
+	}
+	now := time.Now()
+	ok, err := guard.eval(script.RWLockRenew, guard.member(guard.mode))
+	if err != nil {
+		return time.Since(guard.renewedAt) < guard.option.expiration
+	}
+	if ok {
+		guard.renewedAt = now
+	}
+	return ok
+}
+
+// release releases whatever the guard holds, ctx may be done already.
+func (guard *RWLockGuard) release() {
+	guard.mu.Lock()
+	m := guard.mode
+	guard.mu.Unlock()
+	_ = guard.unlock(context.Background(), m)
+}
+
+func (guard *RWLockGuard) lock(ctx context.Context, s string, m mode) error {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+	if guard.mode != modeNone {
+		return fmt.Errorf("key: %s, err: lock already held", guard.key)
+	}
+	b := backoff.NewStrategyBackOff(backoff.ExponentialBackoffFullJitterStrategy{
+		ExponentialBackoff: backoff.ExponentialBackoff{
+			Base: 20 * time.Millisecond,
+			Cap:  100 * time.Millisecond,
+		}})
+	for i := 0; i < guard.option.retryTimes; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		now := time.Now()
+		ok, err := guard.eval(s, guard.id)
+		if err != nil {
+			return err
+		}
+		if ok {
+			guard.mode = m
+			guard.renewedAt = now
+			return nil
+		}
+		if i+1 < guard.option.retryTimes && !sleep(ctx, b.NextBackOff()) {
+			break
+		}
+	}
+	return fmt.Errorf("key: %s, err: %w", guard.key, errLockNotObtained)
+}
+
+func (guard *RWLockGuard) unlock(ctx context.Context, m mode) error {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+	if m == modeNone || guard.mode != m {
+		return fmt.Errorf("key: %s, err: %w", guard.key, errNotLocked)
+	}
+	guard.mode = modeNone
+	return guard.redis.Eval(script.RWLockRelease, []string{guard.key}, guard.member(m)).Err()
+}
+
+// member is the sorted set member of the guard in mode m.
+func (guard *RWLockGuard) member(m mode) string {
+	if m == modeWrite {
+		return "w:" + guard.id
+	}
+	return "r:" + guard.id
+}
+
+func (guard *RWLockGuard) eval(s string, arg string) (bool, error) {
+	n, err := guard.redis.Eval(s,
+		[]string{guard.key},
+		arg,
+		timekit.NowInMillis(),
+		timekit.DurationToMillis(guard.option.expiration),
+	).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
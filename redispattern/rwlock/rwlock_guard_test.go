@@ -0,0 +1,189 @@
+package rwlock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/script"
+	"github.com/xiaojiaoyu100/lizard/redispattern/lockguard/memrediser"
+)
+
+var _ rediser = (*memrediser.Client)(nil)
+
+func TestUpgrade(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	ctx := context.Background()
+
+	var guards [3]*RWLockGuard
+	for i := range guards {
+		guard, err := New(mem, "rwlock:upgrade")
+		if err != nil {
+			t.Fatal(err)
+		}
+		guards[i] = guard
+	}
+	a, b, w := guards[0], guards[1], guards[2]
+	if _, err := a.Upgrade(ctx); !IsNotLocked(err) {
+		t.Fatalf("upgrade without read hold, want not locked, got: %v", err)
+	}
+	for _, g := range []*RWLockGuard{a, b} {
+		if err := g.RLock(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Lock(ctx); !IsLockNotObtained(err) {
+		t.Fatalf("lock while read, want not obtained, got: %v", err)
+	}
+	if ok, err := a.Upgrade(ctx); err != nil || ok {
+		t.Fatalf("upgrade with another reader: %t, %v, want: false, nil", ok, err)
+	}
+	if err := b.RUnlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := a.Upgrade(ctx); err != nil || !ok {
+		t.Fatalf("upgrade as sole reader: %t, %v, want: true, nil", ok, err)
+	}
+	if err := b.RLock(ctx); !IsLockNotObtained(err) {
+		t.Fatalf("read while written, want not obtained, got: %v", err)
+	}
+	if err := a.RUnlock(ctx); !IsNotLocked(err) {
+		t.Fatalf("RUnlock after upgrade, want not locked, got: %v", err)
+	}
+	if err := a.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Lock(ctx); err != nil {
+		t.Errorf("lock once released: %v", err)
+	}
+}
+
+func TestRunMixedContention(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+
+	var (
+		wg      sync.WaitGroup
+		readers int32
+		writers int32
+		runs    int32
+	)
+	read := func(ctx context.Context) error {
+		atomic.AddInt32(&readers, 1)
+		if atomic.LoadInt32(&writers) != 0 {
+			t.Error("reader inside a write")
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&readers, -1)
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}
+	write := func(ctx context.Context) error {
+		if n := atomic.AddInt32(&writers, 1); n != 1 {
+			t.Errorf("%d writers inside a write", n)
+		}
+		if atomic.LoadInt32(&readers) != 0 {
+			t.Error("writer inside a read")
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&writers, -1)
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			guard, err := New(mem, "rwlock:mixed", WithRetryTimes(10000))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for j := 0; j < 3; j++ {
+				if i%3 == 0 {
+					err = guard.WRun(context.Background(), write)
+				} else {
+					err = guard.RRun(context.Background(), read)
+				}
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if runs != 36 {
+		t.Errorf("runs: %d, want: 36", runs)
+	}
+	if ok, _ := mem.SetNX("rwlock:mixed", "x", 0).Result(); !ok {
+		t.Error("every hold should be released")
+	}
+}
+
+func TestRRunReleasesAfterUpgradeAndPanic(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	ctx := context.Background()
+
+	guard, err := New(mem, "rwlock:panic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	boom := errors.New("boom")
+	err = guard.RRun(ctx, func(ctx context.Context) error {
+		if ok, err := guard.Upgrade(ctx); err != nil || !ok {
+			t.Errorf("upgrade: %t, %v, want: true, nil", ok, err)
+		}
+		panic(boom)
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("want: %v, got: %v", boom, err)
+	}
+	other, err := New(mem, "rwlock:panic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Lock(ctx); err != nil {
+		t.Errorf("lock after release: %v", err)
+	}
+}
+
+// renewFailingRediser fails every renewal.
+type renewFailingRediser struct {
+	*memrediser.Client
+	renewals int32
+}
+
+func (r *renewFailingRediser) Eval(s string, keys []string, args ...interface{}) *redis.Cmd {
+	if s == script.RWLockRenew {
+		atomic.AddInt32(&r.renewals, 1)
+		return redis.NewCmdResult(nil, errors.New("i/o timeout"))
+	}
+	return r.Client.Eval(s, keys, args...)
+}
+
+func TestRenewGivesUpAfterExpiration(t *testing.T) {
+	mem := memrediser.New()
+	defer mem.Close()
+	r := &renewFailingRediser{Client: mem}
+	guard, err := New(r, "rwlock:renew", WithExpiration(60*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = guard.WRun(context.Background(), func(ctx context.Context) error {
+		time.Sleep(250 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每20ms续期一次，60ms后不再重试.
+	if n := atomic.LoadInt32(&r.renewals); n == 0 || n > 4 {
+		t.Errorf("renewals: %d, want them to stop once expiration passed", n)
+	}
+}
@@ -0,0 +1,20 @@
+package semaphore
+
+import "errors"
+
+// Error error
+type Error string
+
+const (
+	errPermitNotObtained = Error("permit not obtained")
+)
+
+// Error reports an error.
+func (e Error) Error() string {
+	return string(e)
+}
+
+// IsPermitNotObtained reports a permit which is not obtained.
+func IsPermitNotObtained(err error) bool {
+	return errors.Is(err, errPermitNotObtained)
+}
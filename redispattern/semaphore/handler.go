@@ -0,0 +1,6 @@
+package semaphore
+
+import "context"
+
+// Handler signature.
+type Handler func(ctx context.Context) error
@@ -0,0 +1,157 @@
+package semaphore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/xiaojiaoyu100/lizard/backoff"
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/runner"
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/script"
+	"github.com/xiaojiaoyu100/lizard/timekit"
+)
+
+const (
+	acquireScript = script.SemaphoreAcquire
+	renewScript   = script.SemaphoreRenew
+	releaseScript = script.SemaphoreRelease
+)
+
+// SemaphoreGuard provides a distributed semaphore of limit permits.
+// Every holder is a member of a sorted set scored by its last renewal,
+// holders which stop renewing are dropped once expiration passes.
+type SemaphoreGuard struct {
+	redis  rediser
+	key    string
+	limit  int64
+	id     string
+	option option
+
+	renewedAt time.Time // last time the permit was known to be held
+}
+
+// New 生成一个信号量，同一个SemaphoreGuard实例不可用于并发环境中.
+func New(redis rediser, key string, limit int64, setters ...Setter) (*SemaphoreGuard, error) {
+	if key == "" {
+		return nil, errors.New("key length is zero")
+	}
+	if limit < 1 {
+		return nil, errors.New("limit is less than 1")
+	}
+	o := option{
+		retryTimes: 1,
+		expiration: 30 * time.Second,
+	}
+	for _, setter := range setters {
+		if err := setter(&o); err != nil {
+			return nil, err
+		}
+	}
+	return &SemaphoreGuard{
+		redis:  redis,
+		key:    key,
+		limit:  limit,
+		option: o,
+	}, nil
+}
+
+// Run acquires a permit, runs handler while renewing it and releases it
+// afterwards, even if handler panics. It returns ctx.Err() if ctx ends while
+// waiting for a permit and an error satisfying IsPermitNotObtained once the
+// retry times are used up.
+func (guard *SemaphoreGuard) Run(ctx context.Context, handler Handler) error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	guard.id = id
+	b := backoff.NewStrategyBackOff(backoff.ExponentialBackoffFullJitterStrategy{
+		ExponentialBackoff: backoff.ExponentialBackoff{
+			Base: 20 * time.Millisecond,
+			Cap:  100 * time.Millisecond,
+		}})
+	for i := 0; i < guard.option.retryTimes; i++ {
+		ok, err := guard.acquire()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if i+1 < guard.option.retryTimes && !sleep(ctx, b.NextBackOff()) {
+				return ctx.Err()
+			}
+			continue
+		}
+		return runner.Run(ctx, runner.Renewal{
+			Interval: guard.option.expiration / 3,
+			Jitter:   0.1,
+			Renew:    guard.renew,
+		}, guard.release, handler)
+	}
+	return fmt.Errorf("key: %s, err: %w", guard.key, errPermitNotObtained)
+}
+
+func (guard *SemaphoreGuard) acquire() (bool, error) {
+	now := time.Now()
+	n, err := guard.redis.Eval(acquireScript,
+		[]string{guard.key},
+		guard.limit,
+		timekit.NowInMillis(),
+		guard.id,
+		timekit.DurationToMillis(guard.option.expiration),
+	).Int64()
+	if err != nil {
+		return false, err
+	}
+	if n != 1 {
+		return false, nil
+	}
+	guard.renewedAt = now
+	return true, nil
+}
+
+// renew reports whether the permit may still be held. Errors are treated as
+// transient until expiration has passed since the last renewal, by then the
+// other holders drop the permit anyway.
+func (guard *SemaphoreGuard) renew() bool {
+	now := time.Now()
+	n, err := guard.redis.Eval(renewScript,
+		[]string{guard.key},
+		timekit.NowInMillis(),
+		guard.id,
+		timekit.DurationToMillis(guard.option.expiration),
+	).Int64()
+	if err != nil {
+		return time.Since(guard.renewedAt) < guard.option.expiration
+	}
+	if n != 1 {
+		return false
+	}
+	guard.renewedAt = now
+	return true
+}
+
+func (guard *SemaphoreGuard) release() {
+	guard.redis.Eval(releaseScript, []string{guard.key}, guard.id)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
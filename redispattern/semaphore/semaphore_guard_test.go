@@ -0,0 +1,156 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/fakerediser"
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/runner"
+)
+
+var _ rediser = (*fakerediser.Client)(nil)
+
+// hold runs guard until release is closed and reports once it holds a permit.
+func hold(t *testing.T, guard *SemaphoreGuard, release <-chan struct{}) <-chan error {
+	t.Helper()
+	held := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- guard.Run(context.Background(), func(ctx context.Context) error {
+			close(held)
+			<-release
+			return nil
+		})
+	}()
+	select {
+	case <-held:
+	case err := <-done:
+		t.Fatalf("permit not held: %v", err)
+	}
+	return done
+}
+
+func newTestGuard(t *testing.T, r rediser, key string, limit int64, setters ...Setter) *SemaphoreGuard {
+	guard, err := New(r, key, limit, setters...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return guard
+}
+
+func TestLimit(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	release := make(chan struct{})
+	var done []<-chan error
+	for i := 0; i < 2; i++ {
+		done = append(done, hold(t, newTestGuard(t, c, "semaphore:limit", 2), release))
+	}
+
+	guard := newTestGuard(t, c, "semaphore:limit", 2)
+	err := guard.Run(context.Background(), func(ctx context.Context) error {
+		t.Error("handler run beyond the limit")
+		return nil
+	})
+	if !IsPermitNotObtained(err) {
+		t.Fatalf("want permit not obtained, got: %v", err)
+	}
+	close(release)
+	for _, d := range done {
+		if err := <-d; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := guard.Run(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("run once released: %v", err)
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	release := make(chan struct{})
+	defer close(release)
+	hold(t, newTestGuard(t, c, "semaphore:cancel", 1), release)
+
+	guard := newTestGuard(t, c, "semaphore:cancel", 1, WithRetryTimes(1000))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := guard.Run(ctx, func(ctx context.Context) error { return nil })
+	if err != context.DeadlineExceeded {
+		t.Fatalf("want: %v, got: %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestPanicReleases(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	guard := newTestGuard(t, c, "semaphore:panic", 1)
+	err := guard.Run(context.Background(), func(ctx context.Context) error {
+		panic("boom")
+	})
+	var p *runner.PanicError
+	if !errors.As(err, &p) || p.Value != "boom" {
+		t.Fatalf("want the panic, got: %v", err)
+	}
+	if n, _ := c.ZCard("semaphore:panic").Result(); n != 0 {
+		t.Fatalf("permits held after panic: %d, want: 0", n)
+	}
+}
+
+func TestRenewKeepsPermit(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	release := make(chan struct{})
+	done := hold(t, newTestGuard(t, c, "semaphore:renew", 1, WithExpiration(30*time.Millisecond)), release)
+
+	time.Sleep(100 * time.Millisecond)
+	guard := newTestGuard(t, c, "semaphore:renew", 1)
+	if err := guard.Run(context.Background(), func(ctx context.Context) error { return nil }); !IsPermitNotObtained(err) {
+		t.Fatalf("renewed permit taken over, got: %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// failingRediser fails every script once failing is set.
+type failingRediser struct {
+	*fakerediser.Client
+	failing bool
+}
+
+func (r *failingRediser) Eval(script string, keys []string, args ...interface{}) *redis.Cmd {
+	if r.failing {
+		return redis.NewCmdResult(nil, errors.New("connection refused"))
+	}
+	return r.Client.Eval(script, keys, args...)
+}
+
+func TestRenewGivesUp(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	r := &failingRediser{Client: c}
+	guard := newTestGuard(t, r, "semaphore:giveup", 1, WithExpiration(50*time.Millisecond))
+	guard.id = "holder"
+	if ok, err := guard.acquire(); err != nil || !ok {
+		t.Fatalf("acquire: %t, %v, want: true, nil", ok, err)
+	}
+
+	r.failing = true
+	if !guard.renew() {
+		t.Error("renewal given up on a transient error")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if guard.renew() {
+		t.Error("renewal goes on past the expiration")
+	}
+	r.failing = false
+	if guard.renew() {
+		t.Error("renewal of a dropped permit")
+	}
+}
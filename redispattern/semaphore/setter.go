@@ -0,0 +1,36 @@
+package semaphore
+
+import (
+	"errors"
+	"time"
+)
+
+// Setter configures option.
+type Setter func(o *option) error
+
+type option struct {
+	retryTimes int
+	expiration time.Duration
+}
+
+// WithRetryTimes configures how many times acquiring a permit is tried.
+func WithRetryTimes(t int) Setter {
+	return func(o *option) error {
+		if t < 1 {
+			return errors.New("retry times is less than 1")
+		}
+		o.retryTimes = t
+		return nil
+	}
+}
+
+// WithExpiration configures how long a holder keeps its permit without renewal.
+func WithExpiration(d time.Duration) Setter {
+	return func(o *option) error {
+		if d <= 0 {
+			return errors.New("expiration is not positive")
+		}
+		o.expiration = d
+		return nil
+	}
+}
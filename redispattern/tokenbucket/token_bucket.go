@@ -1,50 +1,25 @@
 package tokenbucket
 
 import (
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"time"
 
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/internal/script"
 	"github.com/xiaojiaoyu100/lizard/timekit"
 )
 
-const script = `
-local key = KEYS[1]
-local rate = tonumber(ARGV[1])
-local tokenNum = tonumber(ARGV[2])
-local now = tonumber(ARGV[3])
-local num = tonumber(ARGV[4])
-local expiration = ARGV[5]
-local obj = {
-tn=tokenNum,
-ts=now
-}
-
-local value = redis.call("get", key)
-if value then
-  obj = cjson.decode(value)
-end
-
-local incr = math.floor((now - obj.ts) / rate)
-if incr > 0 then
-  obj.tn = math.min(obj.tn + incr, tokenNum)
-  obj.ts = obj.ts + incr * rate
-end
-
-if obj.tn >= num then
-  obj.tn = obj.tn - num
-  obj.ts = string.format("%.f", obj.ts)
-  if redis.call("set", key, cjson.encode(obj), "EX", expiration) then
-    return 1
-  end
-end
-
-return 0
-`
+const (
+	consumeScript = script.TokenBucketConsume
+	takeNScript   = script.TokenBucketTakeN
+)
 
-func scriptDigest() (string, error) {
+func digest(script string) (string, error) {
 	s := sha1.New()
 	_, err := io.WriteString(s, script)
 	if err != nil {
@@ -65,7 +40,7 @@ type TokenBucket struct {
 // New returns an instance of TokenBucket
 func New(redis rediser, key string, tokenNum int64, rate time.Duration, expiration int64) (*TokenBucket, error) {
 	h := sha1.New()
-	_, err := io.WriteString(h, script)
+	_, err := io.WriteString(h, consumeScript)
 	if err != nil {
 		return nil, err
 	}
@@ -83,14 +58,6 @@ func New(redis rediser, key string, tokenNum int64, rate time.Duration, expirati
 	}, nil
 }
 
-func (tb *TokenBucket) eva(script string, key string, argv ...interface{}) (int64, error) {
-	ret, err := tb.redis.Eval(script, []string{key}, argv...).Result()
-	if err != nil {
-		return 0, err
-	}
-	return ret.(int64), nil
-}
-
 func (tb *TokenBucket) evaSha1(sha1 string, key string, argv ...interface{}) (int64, error) {
 	ret, err := tb.redis.EvalSha(sha1, []string{key}, argv...).Result()
 	if err != nil {
@@ -104,23 +71,82 @@ func (tb *TokenBucket) Consume(num int64) (bool, error) {
 	if num > tb.TokenNum {
 		return false, errors.New("token is not enough")
 	}
-	digest, err := scriptDigest()
+	digest, err := tb.load(tb.redis, consumeScript)
 	if err != nil {
 		return false, err
 	}
-	exist, err := tb.redis.ScriptExists(digest).Result()
+	ok, err := tb.evaSha1(digest, tb.Key,
+		timekit.DurationToMillis(tb.Rate), tb.TokenNum, timekit.NowInMillis(), num, tb.Expiration)
 	if err != nil {
 		return false, err
 	}
+	return ok == 1, nil
+}
+
+// load makes sure the script is cached by r and returns its digest.
+func (tb *TokenBucket) load(r rediser, script string) (string, error) {
+	digest, err := digest(script)
+	if err != nil {
+		return "", err
+	}
+	exist, err := r.ScriptExists(digest).Result()
+	if err != nil {
+		return "", err
+	}
 	if !exist[0] {
-		_, err := tb.redis.ScriptLoad(script).Result()
+		_, err := r.ScriptLoad(script).Result()
 		if err != nil {
-			return false, err
+			return "", err
 		}
 	}
-	ok, err := tb.evaSha1(digest, tb.Key, timekit.DurationToMillis(tb.Rate), tb.TokenNum, timekit.NowInMillis(), num, tb.Expiration)
+	return digest, nil
+}
+
+// TakeN atomically takes n tokens, e.g. for a batch of n messages. If the
+// bucket holds fewer than n tokens none is taken and TakeN returns false with
+// how long until n tokens will be available at the refill rate, provided
+// nobody else takes any meanwhile. n greater than the bucket size can never
+// be satisfied and fails.
+func (tb *TokenBucket) TakeN(ctx context.Context, n int64) (bool, time.Duration, error) {
+	if n <= 0 {
+		return false, 0, errors.New("n is not positive")
+	}
+	if n > tb.TokenNum {
+		return false, 0, errors.New("n is greater than the bucket size")
+	}
+	if err := ctx.Err(); err != nil {
+		return false, 0, err
+	}
+	r := tb.client(ctx)
+	digest, err := tb.load(r, takeNScript)
 	if err != nil {
-		return false, err
+		return false, 0, err
 	}
-	return ok == 1, nil
+	ret, err := r.EvalSha(digest, []string{tb.Key},
+		timekit.DurationToMillis(tb.Rate), tb.TokenNum, timekit.NowInMillis(), n, tb.Expiration,
+	).Result()
+	if err != nil {
+		return false, 0, err
+	}
+	reply, ok := ret.([]interface{})
+	if !ok || len(reply) != 2 {
+		return false, 0, fmt.Errorf("unexpected reply: %v", ret)
+	}
+	taken, _ := reply[0].(int64)
+	wait, _ := reply[1].(int64)
+	return taken == 1, time.Duration(wait) * time.Millisecond, nil
+}
+
+// client binds ctx to the go-redis clients, which only honour a context set
+// through WithContext. Other clients only see ctx checked before the call.
+func (tb *TokenBucket) client(ctx context.Context) rediser {
+	switch c := tb.redis.(type) {
+	case *redis.Client:
+		return c.WithContext(ctx)
+	case *redis.Ring:
+		return c.WithContext(ctx)
+	case *redis.ClusterClient:
+		return c.WithContext(ctx)
+	}
+	return tb.redis
 }
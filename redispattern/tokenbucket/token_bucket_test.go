@@ -0,0 +1,129 @@
+package tokenbucket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/xiaojiaoyu100/lizard/redispattern/fakerediser"
+)
+
+var _ rediser = (*fakerediser.Client)(nil)
+
+func TestTakeN(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	rate := 20 * time.Millisecond
+	tb, err := New(c, "tokenbucket:taken", 5, rate, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if ok, wait, err := tb.TakeN(ctx, 3); err != nil || !ok || wait != 0 {
+		t.Fatalf("take 3 of 5: %t, %s, %v, want: true, 0s, nil", ok, wait, err)
+	}
+	// 剩余2个，缺3个.
+	ok, wait, err := tb.TakeN(ctx, 5)
+	if err != nil || ok {
+		t.Fatalf("take 5 of 2: %t, %v, want: false, nil", ok, err)
+	}
+	if wait <= 2*rate || wait > 3*rate {
+		t.Fatalf("wait: %s, want within (%s, %s]", wait, 2*rate, 3*rate)
+	}
+	if ok, _, err := tb.TakeN(ctx, 2); err != nil || !ok {
+		t.Fatalf("take 2 of 2 after a denial: %t, %v, want: true, nil", ok, err)
+	}
+	if ok, err := tb.Consume(1); err != nil || ok {
+		t.Fatalf("consume of an empty bucket: %t, %v, want: false, nil", ok, err)
+	}
+
+	_, wait, err = tb.TakeN(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(wait)
+	if ok, _, err := tb.TakeN(ctx, 2); err != nil || !ok {
+		t.Fatalf("take 2 after waiting %s: %t, %v, want: true, nil", wait, ok, err)
+	}
+}
+
+func TestTakeNInvalid(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	tb, err := New(c, "tokenbucket:invalid", 5, 20*time.Millisecond, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := [...]struct {
+		N int64
+	}{
+		0: {0},
+		1: {-1},
+		2: {6},
+	}
+	for i, test := range tests {
+		if ok, _, err := tb.TakeN(context.Background(), test.N); err == nil || ok {
+			t.Errorf("case: %d, take %d of 5: %t, %v, want an error", i, test.N, ok, err)
+		}
+	}
+	// 无效请求不消耗令牌.
+	if ok, _, err := tb.TakeN(context.Background(), 5); err != nil || !ok {
+		t.Errorf("take 5 of 5: %t, %v, want: true, nil", ok, err)
+	}
+}
+
+type ctxKey struct{}
+
+// ctxHook records the value of ctxKey in the context of every command.
+type ctxHook struct {
+	values []interface{}
+}
+
+func (h *ctxHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	h.values = append(h.values, ctx.Value(ctxKey{}))
+	return ctx, nil
+}
+
+func (h *ctxHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (h *ctxHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *ctxHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestTakeNContext(t *testing.T) {
+	c := fakerediser.New()
+	defer c.Close()
+	h := &ctxHook{}
+	c.AddHook(h)
+	tb, err := New(c.Client, "tokenbucket:ctx", 5, 20*time.Millisecond, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "taken")
+	if _, _, err := tb.TakeN(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.values) == 0 {
+		t.Fatal("no command ran")
+	}
+	for i, v := range h.values {
+		if v != "taken" {
+			t.Errorf("%d: command ran without the ctx of TakeN", i)
+		}
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := tb.TakeN(cancelled, 1); err != context.Canceled {
+		t.Errorf("want: %v, got: %v", context.Canceled, err)
+	}
+}